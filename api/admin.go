@@ -3,38 +3,34 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"math"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/anyshare/anyshare-admin-api/enum"
 	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
 	"github.com/anyshare/anyshare-common/mongodb"
 	"github.com/anyshare/anyshare-common/schemas"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ListAdmin lists admins by page, or by cursor when after, before or limit
+// is given. Either way itemCount, and pageCount for pages, come with
+// count=true.
 func ListAdmin(w http.ResponseWriter, r *http.Request) {
-	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
-	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
-	skip := (page - 1) * pageSize
-
 	filter := bson.M{}
-	keyword := strings.TrimSpace(r.URL.Query().Get("keyword"))
-	if keyword != "" {
-		userIds, err := findUsersByKeyword(r.Context(), keyword)
-		if err != nil {
-			w.WriteHeader(500)
-			w.Write([]byte(err.Error()))
-			return
-		}
-		filter["userId"] = bson.M{"$in": userIds}
-	}
 	status := strings.TrimSpace(r.URL.Query().Get("status"))
 	switch status {
 	case "deleted":
@@ -42,41 +38,173 @@ func ListAdmin(w http.ResponseWriter, r *http.Request) {
 	default:
 		filter["deleteTime"] = nil
 	}
+	role := strings.TrimSpace(r.URL.Query().Get("role"))
+	if role != "" {
+		filter["roles"] = role
+	}
+	search := services.NewUserSearch(r.URL.Query().Get("keyword")).Fields("email", "fullName")
+
+	if helpers.IsKeysetRequest(r) {
+		listAdminByCursor(w, r, filter, search)
+		return
+	}
+
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
 
-	items := []schemas.Admin{}
-	db := mongodb.GetCollection(items)
+	db := mongodb.GetCollection([]schemas.Admin{})
 
-	count, err := db.CountDocuments(r.Context(), filter)
+	// As in ListUser, counting is left out unless asked for with count=true,
+	// and one more admin than the page holds tells whether there is a next
+	// page.
+	paging := bson.A{
+		bson.M{"$sort": bson.D{{Key: "joinTime", Value: -1}, {Key: "_id", Value: -1}}},
+		bson.M{"$skip": skip},
+		bson.M{"$limit": pageSize + 1},
+	}
+	counted := r.URL.Query().Get("count") == "true"
+	stages := adminMatchStages(filter, search)
+	if counted {
+		stages = append(stages, bson.M{"$facet": bson.M{
+			"items": adminPageStages(search, paging),
+			"total": bson.A{bson.M{"$count": "count"}},
+		}})
+	} else {
+		stages = append(stages, adminPageStages(search, paging)...)
+	}
+	cursor, err := db.Aggregate(r.Context(), stages)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	response := render.M{}
+	items := []models.Admin{}
+	if counted {
+		var result []struct {
+			Items []models.Admin `bson:"items"`
+			Total []struct {
+				Count int64 `bson:"count"`
+			} `bson:"total"`
+		}
+		err = cursor.All(r.Context(), &result)
+		var count int64
+		if len(result) > 0 {
+			items = append(items, result[0].Items...)
+			if len(result[0].Total) > 0 {
+				count = result[0].Total[0].Count
+			}
+		}
+		response["itemCount"] = count
+		response["pageCount"] = math.Ceil(float64(count) / float64(pageSize))
+	} else {
+		err = cursor.All(r.Context(), &items)
+	}
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	pageCount := math.Ceil(float64(count) / float64(pageSize))
+	hasNext := int64(len(items)) > pageSize
+	if hasNext {
+		items = items[:pageSize]
+	}
 
-	cursor, err := db.Aggregate(r.Context(), bson.A{
-		bson.M{"$match": filter},
-		bson.M{"$sort": bson.M{"joinTime": -1}},
-		bson.M{"$skip": skip},
-		bson.M{"$limit": pageSize},
-		bson.M{"$lookup": bson.M{
-			"from":         "users",
-			"localField":   "userId",
-			"foreignField": "_id",
-			"as":           "user",
-		}},
-		bson.M{"$project": bson.M{
-			"user":  bson.M{"$arrayElemAt": []interface{}{"$user", 0}},
-			"roles": "$roles",
-		}},
-	})
+	response["items"] = responses.NewAdmins(r.Context(), items)
+	response["page"] = page
+	response["hasNext"] = hasNext
+	render.JSON(w, r, response)
+}
+
+var adminUserLookup = bson.A{
+	bson.M{"$lookup": bson.M{
+		"from":         "users",
+		"localField":   "userId",
+		"foreignField": "_id",
+		"as":           "user",
+	}},
+	bson.M{"$addFields": bson.M{"user": bson.M{"$arrayElemAt": bson.A{"$user", 0}}}},
+}
+
+var adminProjection = bson.M{
+	"userId":     1,
+	"user":       1,
+	"roles":      1,
+	"joinTime":   1,
+	"deleteTime": 1,
+	"version":    1,
+	"scope":      1,
+}
+
+// adminMatchStages selects the admins matching filter and, when searching,
+// joins their user first so the keyword is matched in the same aggregation.
+func adminMatchStages(filter bson.M, search *services.UserSearch) bson.A {
+	stages := bson.A{bson.M{"$match": filter}}
+	if !search.IsEmpty() {
+		stages = append(stages, adminUserLookup...)
+		stages = append(stages, bson.M{"$match": bson.M{"$and": search.Conditions("user.")}})
+	}
+	return stages
+}
+
+// adminPageStages applies paging, joining users afterwards when the match
+// stages did not already, so only the returned page is looked up.
+func adminPageStages(search *services.UserSearch, paging bson.A) bson.A {
+	stages := append(bson.A{}, paging...)
+	if search.IsEmpty() {
+		stages = append(stages, adminUserLookup...)
+	}
+	return append(stages, bson.M{"$project": adminProjection})
+}
+
+func listAdminByCursor(w http.ResponseWriter, r *http.Request, filter bson.M, search *services.UserSearch) {
+	ks, err := helpers.ParseKeyset(r)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	items := []models.Admin{}
+	db := mongodb.GetCollection([]schemas.Admin{})
+
+	result := render.M{}
+	if r.URL.Query().Get("count") == "true" {
+		cursor, err := db.Aggregate(r.Context(), append(adminMatchStages(filter, search), bson.M{"$count": "count"}))
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		var total []struct {
+			Count int64 `bson:"count"`
+		}
+		err = cursor.All(r.Context(), &total)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		result["itemCount"] = int64(0)
+		if len(total) > 0 {
+			result["itemCount"] = total[0].Count
+		}
+	}
+
+	stages := adminMatchStages(bson.M{"$and": bson.A{filter, ks.Filter()}}, search)
+	stages = append(stages, adminPageStages(search, bson.A{
+		bson.M{"$sort": ks.Sort()},
+		bson.M{"$limit": ks.Limit + 1},
+	})...)
+	cursor, err := db.Aggregate(r.Context(), stages)
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
 	for cursor.Next(r.Context()) {
-		item := schemas.Admin{}
+		item := models.Admin{}
 		err := cursor.Decode(&item)
 		if err != nil {
 			w.WriteHeader(500)
@@ -86,12 +214,14 @@ func ListAdmin(w http.ResponseWriter, r *http.Request) {
 		items = append(items, item)
 	}
 
-	render.JSON(w, r, render.M{
-		"items":     items,
-		"page":      page,
-		"itemCount": count,
-		"pageCount": pageCount,
+	items, next, prev := helpers.Page(ks, items, func(item models.Admin) helpers.Cursor {
+		return helpers.Cursor{JoinTime: item.JoinTime, ID: item.ID}
 	})
+	helpers.SetLinkHeader(w, r, next, prev)
+	result["items"] = responses.NewAdmins(r.Context(), items)
+	result["next"] = next
+	result["prev"] = prev
+	render.JSON(w, r, result)
 }
 
 func GetAdmin(w http.ResponseWriter, r *http.Request) {
@@ -101,23 +231,113 @@ func GetAdmin(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(err.Error()))
 		return
 	}
-	item := schemas.Admin{}
-	mongodb.GetCollection(item).FindOne(r.Context(), bson.M{"_id": id}).Decode(&item)
+	item, err := findAdmin(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	if item.ID.IsZero() {
 		w.WriteHeader(404)
 		return
 	}
-	render.JSON(w, r, item)
+	if helpers.NotModified(w, r, item.Version) {
+		return
+	}
+	render.JSON(w, r, responses.NewAdmin(r.Context(), item))
+}
+
+// findAdmin loads an admin joined with its user, the result is zero when no
+// admin has the id.
+func findAdmin(ctx context.Context, id primitive.ObjectID) (models.Admin, error) {
+	item := models.Admin{}
+	stages := append(bson.A{bson.M{"$match": bson.M{"_id": id}}}, adminUserLookup...)
+	cursor, err := mongodb.GetCollection(schemas.Admin{}).Aggregate(ctx, stages)
+	if err != nil {
+		return item, err
+	}
+	defer cursor.Close(ctx)
+	if cursor.Next(ctx) {
+		err = cursor.Decode(&item)
+	}
+	return item, err
+}
+
+// adminHistoryFields are the fields of an admin tracked by the change history.
+func adminHistoryFields(admin models.Admin) bson.M {
+	roles := admin.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return bson.M{
+		"roles":      roles,
+		"deleteTime": admin.DeleteTime,
+		"scope":      admin.Scope,
+	}
+}
+
+func recordAdminHistory(r *http.Request, admin models.Admin, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.AdminCollection, admin.ID, action, adminHistoryFields(admin), update)
+	if err != nil {
+		log.Println("record admin history:", err)
+	}
+}
+
+// lockoutConflict writes a localized 409 response and returns true when err
+// breaks one of the invariants keeping admins from locking everyone out.
+func lockoutConflict(w http.ResponseWriter, r *http.Request, err error) bool {
+	var key string
+	switch {
+	case errors.Is(err, services.ErrLastSuperAdmin):
+		key = "lastSuperAdmin"
+	case errors.Is(err, services.ErrSelfDelete):
+		key = "selfDelete"
+	case errors.Is(err, services.ErrSelfDemote):
+		key = "selfDemote"
+	default:
+		return false
+	}
+	w.WriteHeader(409)
+	render.JSON(w, r, render.M{"message": helpers.Translate(r.Context(), key)})
+	return true
+}
+
+// renderAdmin responds with the current state of an admin along with its ETag.
+func renderAdmin(w http.ResponseWriter, r *http.Request, id primitive.ObjectID) {
+	item, err := findAdmin(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	helpers.SetETag(w, item.Version)
+	render.JSON(w, r, responses.NewAdmin(r.Context(), item))
+}
+
+// findActiveAdmin loads the admin in the "id" URL parameter, writing the
+// error response and returning false when there is no such active admin.
+func findActiveAdmin(w http.ResponseWriter, r *http.Request) (models.Admin, bool) {
+	admin := models.Admin{}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return admin, false
+	}
+	models.Collection(models.AdminCollection).FindOne(r.Context(), bson.M{"_id": id, "deleteTime": nil}).Decode(&admin)
+	if admin.ID.IsZero() {
+		w.WriteHeader(404)
+		return admin, false
+	}
+	return admin, true
 }
 
+// CreateAdmin promotes an existing user to admin with the given roles.
 func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var form struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,min=7,max=50"`
-		FullName string `json:"fullName" validate:"required,max=50"`
-		Address  string `json:"address" validate:"required,max=250"`
-		Desc     string `json:"desc" validate:"max=1000"`
+		UserID string   `json:"userId" validate:"required"`
+		Roles  []string `json:"roles" validate:"required,min=1,unique,dive,role"`
 	}
 	err := decoder.Decode(&form)
 	if err != nil {
@@ -130,24 +350,64 @@ func CreateAdmin(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, formErrors)
 		return
 	}
-	user := schemas.User{}
-	hash, _ := bcrypt.GenerateFromPassword([]byte(form.Password), 10)
-	result, err := mongodb.GetCollection(user).InsertOne(r.Context(), schemas.User{
-		Email:    form.Email,
-		Password: string(hash),
-		FullName: form.FullName,
-		Address:  form.Address,
-		Desc:     form.Desc,
-		JoinTime: time.Now().Unix(),
-	})
+	userID, err := primitive.ObjectIDFromHex(form.UserID)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !services.CanAssignRoles(r.Context(), form.Roles) {
+		w.WriteHeader(403)
+		return
+	}
+	user := models.User{}
+	mongodb.GetCollection(user.User).FindOne(r.Context(), bson.M{"_id": userID, "deleteTime": nil}).Decode(&user)
+	if user.ID.IsZero() {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"userId": helpers.Translate(r.Context(), "accountNotExist")})
+		return
+	}
+	db := models.Collection(models.AdminCollection)
+	count, err := db.CountDocuments(r.Context(), bson.M{"userId": userID, "deleteTime": nil})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if count > 0 {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"userId": helpers.Translate(r.Context(), "alreadyAdmin")})
+		return
+	}
+	if services.GainsPermissions(r.Context(), nil, form.Roles) && requireApproval(w, r, "CreateAdmin", models.Approval{
+		Action:     models.ApprovalRoleEscalation,
+		Permission: enum.PermissionAdminWrite,
+		Roles:      form.Roles,
+		TargetID:   userID,
+	}, form) {
+		return
+	}
+	admin := models.Admin{UserID: userID, Roles: form.Roles, JoinTime: time.Now().Unix()}
+	result, err := db.InsertOne(r.Context(), admin)
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"userId": helpers.Translate(r.Context(), "alreadyAdmin")})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	admin.ID = result.InsertedID.(primitive.ObjectID)
+	recordAdminHistory(r, models.Admin{ID: admin.ID}, services.HistoryActionCreate, bson.M{"roles": admin.Roles})
+	renderAdmin(w, r, admin.ID)
 }
 
+// UpdateAdmin edits the profile of an admin's user account, given by its id,
+// and optionally resets its password. Like revoking them, it takes being able
+// to assign every role the admin holds. It answers with the admin, like the
+// other admin endpoints.
 func UpdateAdmin(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var form struct {
@@ -174,71 +434,263 @@ func UpdateAdmin(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(err.Error()))
 		return
 	}
-	user := schemas.User{}
-	db := mongodb.GetCollection(user)
-	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
+	db.FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&user)
 	if user.ID.IsZero() {
 		w.WriteHeader(404)
 		return
 	}
+	admin := models.Admin{}
+	models.Collection(models.AdminCollection).FindOne(r.Context(), bson.M{"userId": id, "deleteTime": nil}).Decode(&admin)
+	if admin.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if !services.CanAssignRoles(r.Context(), admin.Roles) {
+		w.WriteHeader(403)
+		return
+	}
+	// The admin's ETag is that of its record, which the edit bumps so that
+	// clients holding the profile before it get a 412.
+	if helpers.PreconditionFailed(w, r, admin.Version) {
+		return
+	}
+	result, err := helpers.UpdateVersion(r.Context(), models.Collection(models.AdminCollection), admin.ID, admin.Version, bson.M{})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
 	updateData := bson.M{
 		"fullName": form.FullName,
 		"address":  form.Address,
 		"desc":     form.Desc,
+		"search":   services.UserSearchFields(user.Email, form.FullName, form.Address),
 	}
 	if form.Password != "" {
 		hash, _ := bcrypt.GenerateFromPassword([]byte(form.Password), 10)
 		updateData["password"] = string(hash)
 	}
-	result, err := db.UpdateByID(r.Context(), id, bson.M{"$set": updateData})
+	result, err = helpers.UpdateVersion(r.Context(), db, id, user.Version, bson.M{"$set": updateData})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordUserHistory(r, user, services.HistoryActionUpdate, updateData)
+	renderAdmin(w, r, admin.ID)
 }
 
-func DeleteAdmin(w http.ResponseWriter, r *http.Request) {
-	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+// UpdateAdminRoles replaces the roles of an admin. Both the granted and the
+// revoked roles must be assignable by the current admin.
+func UpdateAdminRoles(w http.ResponseWriter, r *http.Request) {
+	admin, ok := findActiveAdmin(w, r)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Roles []string `json:"roles" validate:"required,min=1,unique,dive,role"`
+	}
+	err := decoder.Decode(&form)
 	if err != nil {
 		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	granted := []string{}
+	for _, role := range form.Roles {
+		if !slices.Contains(admin.Roles, role) {
+			granted = append(granted, role)
+		}
+	}
+	changed := slices.Clone(granted)
+	for _, role := range admin.Roles {
+		if !slices.Contains(form.Roles, role) {
+			changed = append(changed, role)
+		}
+	}
+	if !services.CanAssignRoles(r.Context(), changed) {
+		w.WriteHeader(403)
+		return
+	}
+	err = services.CheckOwnRoles(r.Context(), admin, form.Roles)
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if helpers.PreconditionFailed(w, r, admin.Version) {
+		return
+	}
+	if services.GainsPermissions(r.Context(), admin.Roles, granted) && requireApproval(w, r, "UpdateAdminRoles", models.Approval{
+		Action:     models.ApprovalRoleEscalation,
+		Permission: enum.PermissionAdminWrite,
+		Roles:      granted,
+		TargetID:   admin.ID,
+	}, form) {
+		return
+	}
+	updateData := bson.M{"roles": form.Roles}
+	result, err := services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		return helpers.UpdateVersion(ctx, models.Collection(models.AdminCollection), admin.ID, admin.Version, bson.M{"$set": updateData})
+	})
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	user := schemas.User{}
-	db := mongodb.GetCollection(user)
-	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
-	if user.ID.IsZero() {
-		w.WriteHeader(404)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordAdminHistory(r, admin, services.HistoryActionUpdate, updateData)
+	renderAdmin(w, r, admin.ID)
+}
+
+// DeleteAdmin revokes admin status, the user account is left intact.
+func DeleteAdmin(w http.ResponseWriter, r *http.Request) {
+	admin, ok := findActiveAdmin(w, r)
+	if !ok {
+		return
+	}
+	if !services.CanAssignRoles(r.Context(), admin.Roles) {
+		w.WriteHeader(403)
+		return
+	}
+	if lockoutConflict(w, r, services.CheckSelf(r.Context(), admin.UserID)) {
+		return
+	}
+	if helpers.PreconditionFailed(w, r, admin.Version) {
+		return
+	}
+	if requireApproval(w, r, "DeleteAdmin", models.Approval{
+		Action:     models.ApprovalAdminDelete,
+		Permission: enum.PermissionAdminWrite,
+		TargetID:   admin.ID,
+	}, nil) {
+		return
+	}
+	updateData := bson.M{"deleteTime": time.Now().Unix()}
+	result, err := services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		return helpers.UpdateVersion(ctx, models.Collection(models.AdminCollection), admin.ID, admin.Version, bson.M{"$set": updateData})
+	})
+	if lockoutConflict(w, r, err) {
 		return
 	}
-	result, err := db.UpdateByID(r.Context(), id, bson.M{"$set": bson.M{"deleteTime": time.Now().Unix()}})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordAdminHistory(r, admin, services.HistoryActionDelete, updateData)
+	renderAdmin(w, r, admin.ID)
 }
 
-func findUsersByKeyword(ctx context.Context, keyword string) (userIds []primitive.ObjectID, err error) {
-	var pageSize int64 = 30
-	cursor, err := mongodb.GetCollection(schemas.User{}).
-		Find(ctx,
-			bson.M{"$regex": keyword},
-			&options.FindOptions{Limit: &pageSize, Sort: bson.D{{Key: "joinTime", Value: -1}}},
-		)
+// UpdateAdminScope limits the users an admin manages, an empty scope lifts
+// the limit. Scoped admins cannot change scopes, their own included.
+func UpdateAdminScope(w http.ResponseWriter, r *http.Request) {
+	admin, ok := findActiveAdmin(w, r)
+	if !ok {
+		return
+	}
+	if services.ScopeFilter(r.Context()) != nil || !services.CanAssignRoles(r.Context(), admin.Roles) {
+		w.WriteHeader(403)
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		GroupIDs   []string                 `json:"groupIds" validate:"unique"`
+		Attributes map[string][]interface{} `json:"attributes" validate:"dive,min=1"`
+	}
+	err := decoder.Decode(&form)
 	if err != nil {
-		return nil, err
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	scope := &models.Scope{Attributes: form.Attributes}
+	for _, value := range form.GroupIDs {
+		groupID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		scope.GroupIDs = append(scope.GroupIDs, groupID)
 	}
-	for cursor.Next(ctx) {
-		user := schemas.User{}
-		err := cursor.Decode(&user)
+	if len(scope.GroupIDs) > 0 {
+		count, err := models.Collection(models.GroupCollection).CountDocuments(r.Context(), bson.M{"_id": bson.M{"$in": scope.GroupIDs}})
 		if err != nil {
-			return nil, err
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
 		}
-		userIds = append(userIds, user.ID)
+		if count != int64(len(scope.GroupIDs)) {
+			w.WriteHeader(422)
+			render.JSON(w, r, render.M{"groupIds": helpers.Translate(r.Context(), "groupNotFound")})
+			return
+		}
+	}
+	if len(scope.Attributes) > 0 {
+		definitions, err := services.AttributeDefinitions(r.Context())
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		for key := range scope.Attributes {
+			if !slices.ContainsFunc(definitions, func(def models.AttributeDefinition) bool { return def.Key == key }) {
+				w.WriteHeader(422)
+				render.JSON(w, r, render.M{"attributes." + key: helpers.Translate(r.Context(), "unknownAttribute")})
+				return
+			}
+		}
+	}
+	if helpers.PreconditionFailed(w, r, admin.Version) {
+		return
+	}
+	var update bson.M
+	if scope.IsEmpty() {
+		scope = nil
+		update = bson.M{"$unset": bson.M{"scope": ""}}
+	} else {
+		update = bson.M{"$set": bson.M{"scope": scope}}
+	}
+	result, err := helpers.UpdateVersion(r.Context(), models.Collection(models.AdminCollection), admin.ID, admin.Version, update)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
 	}
-	return userIds, nil
+	recordAdminHistory(r, admin, services.HistoryActionUpdate, bson.M{"scope": scope})
+	renderAdmin(w, r, admin.ID)
 }
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/services"
+)
+
+func TestLockoutConflict(t *testing.T) {
+	tests := []struct {
+		err     error
+		locale  string
+		handled bool
+		message string
+	}{
+		{services.ErrLastSuperAdmin, "en", true, "At least one active superadmin must remain"},
+		{fmt.Errorf("delete admin: %w", services.ErrSelfDelete), "en", true, "You cannot delete your own account or admin rights"},
+		{services.ErrSelfDemote, "en", true, "You cannot remove your own highest role"},
+		{services.ErrLastSuperAdmin, "vi", true, ""},
+		{errors.New("other"), "en", false, ""},
+		{nil, "en", false, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("DELETE", "/admin/1", nil)
+		r = r.WithContext(context.WithValue(r.Context(), enum.ContextKeyLocale, tt.locale))
+		if got := lockoutConflict(w, r, tt.err); got != tt.handled {
+			t.Errorf("%v: lockoutConflict = %v, want %v", tt.err, got, tt.handled)
+			continue
+		}
+		if !tt.handled {
+			if w.Body.Len() > 0 {
+				t.Errorf("%v: wrote %q", tt.err, w.Body.String())
+			}
+			continue
+		}
+		if w.Code != 409 {
+			t.Errorf("%v: status = %d, want 409", tt.err, w.Code)
+		}
+		body := w.Body.String()
+		if tt.message != "" && !strings.Contains(body, tt.message) {
+			t.Errorf("%v: body = %s, want %q", tt.err, body, tt.message)
+		}
+		if tt.locale == "vi" && (strings.Contains(body, "At least one") || strings.Contains(body, "lastSuperAdmin")) {
+			t.Errorf("%v: body = %s, want a Vietnamese message", tt.err, body)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests from the repository root, where the server runs and
+// translations are loaded from.
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,362 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// approvalHandlers are the handlers requireApproval can put on hold, by the
+// name stored in models.Approval.Handler.
+var approvalHandlers = map[string]http.HandlerFunc{
+	"CreateAdmin":      CreateAdmin,
+	"UpdateAdminRoles": UpdateAdminRoles,
+	"DeleteAdmin":      DeleteAdmin,
+	"InviteAdmin":      InviteAdmin,
+	"GroupAction":      GroupAction,
+	"CreateGrant":      CreateGrant,
+	"CreateRole":       CreateRole,
+	"UpdateRole":       UpdateRole,
+	"MergeUser":        MergeUser,
+	"RevertMerge":      RevertMerge,
+}
+
+// approvalHistoryFields leaves out the stored request, whose body may hold
+// personal data.
+func approvalHistoryFields(approval models.Approval) bson.M {
+	return bson.M{
+		"action":       approval.Action,
+		"handler":      approval.Handler,
+		"targetId":     approval.TargetID,
+		"status":       approval.Status,
+		"reviewedBy":   approval.ReviewedBy,
+		"reason":       approval.Reason,
+		"resultStatus": approval.ResultStatus,
+		"expireTime":   approval.ExpireTime,
+		"reviewTime":   approval.ReviewTime,
+		"executeTime":  approval.ExecuteTime,
+	}
+}
+
+func recordApprovalHistory(r *http.Request, approval models.Approval, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.ApprovalCollection, approval.ID, action, approvalHistoryFields(approval), update)
+	if err != nil {
+		log.Println("record approval history:", err)
+	}
+}
+
+// requireApproval puts the request on hold when approval.Action needs a
+// second admin's approval: it stores the request, answers 202 with the
+// pending approval and returns true. form is the decoded body, stored to run
+// the request again once approved, when it goes through.
+//
+// Requests nobody else could approve are refused with 409 rather than run
+// unapproved, as on a fresh install where the first superadmin is the only
+// admin: another admin must be added first, or the action left out of
+// APPROVAL_ACTIONS.
+func requireApproval(w http.ResponseWriter, r *http.Request, handler string, approval models.Approval, form interface{}) bool {
+	if _, ok := r.Context().Value(enum.ContextKeyApproval).(models.Approval); ok || !services.ApprovalRequired(approval.Action) {
+		return false
+	}
+	actor, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	needed := append([]string{approval.Permission}, approval.Permissions...)
+	if len(approval.Roles) > 0 {
+		permissions, err := services.EffectivePermissions(r.Context(), approval.Roles)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return true
+		}
+		needed = append(append(needed, enum.PermissionAdminWrite), permissions...)
+	}
+	approval.RequestedBy = actor.ID
+	approverExists, err := services.ApproverExists(r.Context(), approval, needed)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return true
+	}
+	if !approverExists {
+		w.WriteHeader(409)
+		render.JSON(w, r, render.M{"message": helpers.Translate(r.Context(), "noApprover")})
+		return true
+	}
+	if form != nil {
+		body, err := json.Marshal(form)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return true
+		}
+		approval.Body = body
+	}
+	approval.Handler = handler
+	approval.Params = map[string]string{}
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			approval.Params[key] = rctx.URLParams.Values[i]
+		}
+	}
+	approval.Query = r.URL.RawQuery
+	approval.IfMatch = r.Header.Get("If-Match")
+	approval.Status = models.ApprovalPending
+	now := time.Now()
+	approval.CreateTime = now.Unix()
+	approval.ExpireTime = now.Add(services.ApprovalTTL()).Unix()
+	result, err := models.Collection(models.ApprovalCollection).InsertOne(r.Context(), approval)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return true
+	}
+	approval.ID = result.InsertedID.(primitive.ObjectID)
+	recordApprovalHistory(r, models.Approval{ID: approval.ID}, services.HistoryActionCreate, approvalHistoryFields(approval))
+	w.WriteHeader(202)
+	render.JSON(w, r, responses.NewApproval(approval, approval.CreateTime))
+	return true
+}
+
+func ListApproval(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	now := time.Now().Unix()
+	filter := bson.M{}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case models.ApprovalPending:
+		filter = bson.M{"status": status, "expireTime": bson.M{"$gt": now}}
+	case models.ApprovalExpired:
+		filter = bson.M{"status": models.ApprovalPending, "expireTime": bson.M{"$lte": now}}
+	default:
+		filter = bson.M{"status": status}
+	}
+	db := models.Collection(models.ApprovalCollection)
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	approvals := []models.Approval{}
+	err = cursor.All(r.Context(), &approvals)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"items":     responses.NewApprovals(approvals, now),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// findApproval loads the approval in the "id" URL parameter, writing the
+// error response and returning false when there is none.
+func findApproval(w http.ResponseWriter, r *http.Request) (models.Approval, bool) {
+	approval := models.Approval{}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return approval, false
+	}
+	models.Collection(models.ApprovalCollection).FindOne(r.Context(), bson.M{"_id": id}).Decode(&approval)
+	if approval.ID.IsZero() {
+		w.WriteHeader(404)
+		return approval, false
+	}
+	return approval, true
+}
+
+func GetApproval(w http.ResponseWriter, r *http.Request) {
+	approval, ok := findApproval(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, responses.NewApproval(approval, time.Now().Unix()))
+}
+
+// reviewApproval moves a pending approval to status on behalf of the current
+// admin, who must be neither the requester nor the admin it acts on and must
+// hold what the request needs. It writes the error response and returns false
+// when that is not possible.
+func reviewApproval(w http.ResponseWriter, r *http.Request, status string, reason string) (models.Approval, bool) {
+	approval, ok := findApproval(w, r)
+	if !ok {
+		return approval, false
+	}
+	actor, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	admin, _ := r.Context().Value(enum.ContextKeyAdmin).(models.Admin)
+	if services.ApprovalParty(approval, admin) || !helpers.HasPermission(r.Context(), approval.Permission) {
+		w.WriteHeader(403)
+		return approval, false
+	}
+	if len(approval.Roles) > 0 && !services.CanAssignRoles(r.Context(), approval.Roles) {
+		w.WriteHeader(403)
+		return approval, false
+	}
+	if !services.HoldsPermissions(r.Context(), approval.Permissions) {
+		w.WriteHeader(403)
+		return approval, false
+	}
+	before := approval
+	now := time.Now().Unix()
+	update := bson.M{"status": status, "reviewedBy": actor.ID, "reviewTime": now}
+	if reason != "" {
+		update["reason"] = reason
+	}
+	err := models.Collection(models.ApprovalCollection).FindOneAndUpdate(r.Context(), bson.M{
+		"_id":        approval.ID,
+		"status":     models.ApprovalPending,
+		"expireTime": bson.M{"$gt": now},
+	}, bson.M{"$set": update}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&approval)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		w.WriteHeader(409)
+		return approval, false
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return approval, false
+	}
+	recordApprovalHistory(r, before, services.HistoryActionUpdate, update)
+	return approval, true
+}
+
+// ApproveApproval runs the request on hold as the admin who made it, with
+// their current permissions, and answers with its response. The approver is
+// recorded along with the requester in the history of the changes it makes.
+func ApproveApproval(w http.ResponseWriter, r *http.Request) {
+	approval, ok := reviewApproval(w, r, models.ApprovalApproved, "")
+	if !ok {
+		return
+	}
+	recorder := httptest.NewRecorder()
+	err := runApproval(r.Context(), approval, recorder)
+	if err != nil {
+		recorder = httptest.NewRecorder()
+		recorder.WriteHeader(500)
+		recorder.Write([]byte(err.Error()))
+	}
+	status := models.ApprovalExecuted
+	if recorder.Code >= 400 {
+		status = models.ApprovalFailed
+	}
+	update := bson.M{
+		"status":       status,
+		"resultStatus": recorder.Code,
+		"executeTime":  time.Now().Unix(),
+	}
+	_, err = models.Collection(models.ApprovalCollection).UpdateOne(r.Context(), bson.M{"_id": approval.ID}, bson.M{"$set": update})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordApprovalHistory(r, approval, services.HistoryActionUpdate, update)
+	for key, values := range recorder.Header() {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(recorder.Code)
+	w.Write(recorder.Body.Bytes())
+}
+
+// runApproval replays the stored request through its handler into w.
+func runApproval(ctx context.Context, approval models.Approval, w http.ResponseWriter) error {
+	handler, ok := approvalHandlers[approval.Handler]
+	if !ok {
+		return errors.New("unknown approval handler " + approval.Handler)
+	}
+	ctx, err := services.LoadIdentity(ctx, approval.RequestedBy)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		w.WriteHeader(403)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !helpers.HasPermission(ctx, approval.Permission) {
+		w.WriteHeader(403)
+		return nil
+	}
+	req, err := replayRequest(ctx, approval)
+	if err != nil {
+		return err
+	}
+	handler(w, req)
+	return nil
+}
+
+// replayRequest rebuilds the request stored in approval, carrying the
+// approval in its context so that it is not put on hold again.
+func replayRequest(ctx context.Context, approval models.Approval) (*http.Request, error) {
+	rctx := chi.NewRouteContext()
+	for key, value := range approval.Params {
+		rctx.URLParams.Add(key, value)
+	}
+	ctx = context.WithValue(ctx, chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, enum.ContextKeyApproval, approval)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/?"+approval.Query, bytes.NewReader(approval.Body))
+	if err != nil {
+		return nil, err
+	}
+	if approval.IfMatch != "" {
+		req.Header.Set("If-Match", approval.IfMatch)
+	}
+	return req, nil
+}
+
+func RejectApproval(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	approval, ok := reviewApproval(w, r, models.ApprovalRejected, form.Reason)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, responses.NewApproval(approval, time.Now().Unix()))
+}
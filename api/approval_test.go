@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReplayRequest(t *testing.T) {
+	approval := models.Approval{
+		ID:      primitive.NewObjectID(),
+		Action:  models.ApprovalRoleEscalation,
+		Handler: "GroupAction",
+		Params:  map[string]string{"id": "65a0c0ffee0000000000beef"},
+		Query:   "status=active&tag=vip",
+		Body:    []byte(`{"roles":["admin"]}`),
+		IfMatch: `"4"`,
+	}
+	req, err := replayRequest(context.Background(), approval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := chi.URLParam(req, "id"); got != approval.Params["id"] {
+		t.Errorf("id = %q, want %q", got, approval.Params["id"])
+	}
+	if got := req.URL.Query().Get("tag"); got != "vip" {
+		t.Errorf("query tag = %q, want vip", got)
+	}
+	if got := req.Header.Get("If-Match"); got != approval.IfMatch {
+		t.Errorf("If-Match = %q, want %q", got, approval.IfMatch)
+	}
+	var form struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&form); err != nil || len(form.Roles) != 1 || form.Roles[0] != "admin" {
+		t.Errorf("body = %v, %v", form, err)
+	}
+	if got, _ := req.Context().Value(enum.ContextKeyApproval).(models.Approval); got.ID != approval.ID {
+		t.Errorf("replayed request runs under approval %v, want %v", got.ID, approval.ID)
+	}
+
+	// The replayed request goes through instead of waiting for approval again.
+	w := httptest.NewRecorder()
+	if requireApproval(w, req, approval.Handler, models.Approval{Action: models.ApprovalRoleEscalation}, form) {
+		t.Error("replayed request put on hold again")
+	}
+	if w.Body.Len() > 0 || w.Code != 200 {
+		t.Errorf("requireApproval wrote %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRequireApprovalTurnedOff(t *testing.T) {
+	t.Setenv("APPROVAL_ACTIONS", "admin.delete")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/roles", nil)
+	if requireApproval(w, r, "CreateRole", models.Approval{Action: models.ApprovalRoleEscalation}, nil) {
+		t.Error("request put on hold for an action needing no approval")
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListAttribute(w http.ResponseWriter, r *http.Request) {
+	defs, err := services.AttributeDefinitions(r.Context())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{"items": defs})
+}
+
+// validateAttributeDefinition reports the errors of a definition, its rules
+// are checked against the validator as well.
+func validateAttributeDefinition(r *http.Request, form interface{}, def models.AttributeDefinition) map[string]string {
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors == nil {
+		formErrors = map[string]string{}
+	}
+	if def.Type == models.AttributeTypeEnum && len(def.EnumValues) == 0 {
+		formErrors["enumValues"] = helpers.Translate(r.Context(), "enumValuesRequired")
+	}
+	if !services.CheckAttributeRules(def) {
+		formErrors["rules"] = helpers.Translate(r.Context(), "invalidAttributeRules")
+	}
+	if len(formErrors) == 0 {
+		return nil
+	}
+	return formErrors
+}
+
+func attributeHistoryFields(def models.AttributeDefinition) bson.M {
+	enumValues := def.EnumValues
+	if enumValues == nil {
+		enumValues = []string{}
+	}
+	labels := def.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return bson.M{
+		"key":        def.Key,
+		"type":       def.Type,
+		"required":   def.Required,
+		"enumValues": enumValues,
+		"rules":      def.Rules,
+		"labels":     labels,
+	}
+}
+
+func recordAttributeHistory(r *http.Request, def models.AttributeDefinition, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.AttributeCollection, def.ID, action, attributeHistoryFields(def), update)
+	if err != nil {
+		log.Println("record attribute history:", err)
+	}
+}
+
+func CreateAttribute(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Key        string            `json:"key" validate:"required,max=50,alphanum"`
+		Type       string            `json:"type" validate:"required,oneof=string number boolean date enum"`
+		Required   bool              `json:"required"`
+		EnumValues []string          `json:"enumValues" validate:"dive,required,max=100,excludesall='0x2C0x7C"`
+		Rules      string            `json:"rules" validate:"max=200"`
+		Labels     map[string]string `json:"labels" validate:"dive,keys,oneof=en vi,endkeys,max=100"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	now := time.Now().Unix()
+	def := models.AttributeDefinition{
+		Key:        form.Key,
+		Type:       form.Type,
+		Required:   form.Required,
+		EnumValues: form.EnumValues,
+		Rules:      form.Rules,
+		Labels:     form.Labels,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	formErrors := validateAttributeDefinition(r, form, def)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	db := models.Collection(models.AttributeCollection)
+	count, err := db.CountDocuments(r.Context(), bson.M{"key": def.Key})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if count > 0 {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"key": helpers.Translate(r.Context(), "attributeKeyTaken")})
+		return
+	}
+	result, err := db.InsertOne(r.Context(), def)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	def.ID = result.InsertedID.(primitive.ObjectID)
+	recordAttributeHistory(r, models.AttributeDefinition{ID: def.ID}, services.HistoryActionCreate, attributeHistoryFields(def))
+	render.JSON(w, r, def)
+}
+
+// UpdateAttribute changes a definition, its key and type are fixed since
+// stored values depend on them. Existing values are not revalidated.
+func UpdateAttribute(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Required   bool              `json:"required"`
+		EnumValues []string          `json:"enumValues" validate:"dive,required,max=100,excludesall='0x2C0x7C"`
+		Rules      string            `json:"rules" validate:"max=200"`
+		Labels     map[string]string `json:"labels" validate:"dive,keys,oneof=en vi,endkeys,max=100"`
+	}
+	err = decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	def := models.AttributeDefinition{}
+	db := models.Collection(models.AttributeCollection)
+	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&def)
+	if def.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	before := def
+	def.Required = form.Required
+	def.EnumValues = form.EnumValues
+	def.Rules = form.Rules
+	def.Labels = form.Labels
+	def.UpdateTime = time.Now().Unix()
+	formErrors := validateAttributeDefinition(r, form, def)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	_, err = db.ReplaceOne(r.Context(), bson.M{"_id": id}, def)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordAttributeHistory(r, before, services.HistoryActionUpdate, attributeHistoryFields(def))
+	render.JSON(w, r, def)
+}
+
+// DeleteAttribute removes a definition along with its values on every user.
+func DeleteAttribute(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	def := models.AttributeDefinition{}
+	db := models.Collection(models.AttributeCollection)
+	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&def)
+	if def.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	_, err = db.DeleteOne(r.Context(), bson.M{"_id": id})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordAttributeHistory(r, def, services.HistoryActionDelete, attributeHistoryFields(models.AttributeDefinition{}))
+	field := "attributes." + def.Key
+	_, err = mongodb.GetCollection(schemas.User{}).UpdateMany(r.Context(), bson.M{field: bson.M{"$exists": true}}, bson.M{"$unset": bson.M{field: ""}})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(204)
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListAudit lists audit entries, newest first. They can be filtered by
+// actorId, target (a collection), targetId, which also matches any record
+// the request wrote, action and a from/to time range, see
+// helpers.ParseTimeParam.
+func ListAudit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page := helpers.StringToInt64(query.Get("page"), 1)
+	pageSize := helpers.StringToInt64(query.Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	filter := bson.M{}
+	if value := query.Get("actorId"); value != "" {
+		actorID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		filter["actorId"] = actorID
+	}
+	if value := query.Get("target"); value != "" {
+		filter["target.collection"] = value
+	}
+	if value := query.Get("targetId"); value != "" {
+		conditions := bson.A{bson.M{"target.id": value}}
+		if recordID, err := primitive.ObjectIDFromHex(value); err == nil {
+			conditions = append(conditions, bson.M{"changes.recordId": recordID})
+		}
+		filter["$or"] = conditions
+	}
+	if value := query.Get("action"); value != "" {
+		filter["action"] = value
+	}
+	now := time.Now()
+	createTime := bson.M{}
+	for param, op := range map[string]string{"from": "$gte", "to": "$lt"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		unix, err := helpers.ParseTimeParam(value, now)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		createTime[op] = unix
+	}
+	if len(createTime) > 0 {
+		filter["createTime"] = createTime
+	}
+
+	db := models.Collection(models.AuditCollection)
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	entries := []models.AuditEntry{}
+	err = cursor.All(r.Context(), &entries)
+	if err == nil {
+		err = services.RevealAudit(r.Context(), entries)
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"items":     responses.NewAuditEntries(entries),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// GetAuditHistory shows the values behind a change of an audit entry, by its
+// historyId. Changes to users take the same permission and scope as
+// ListUserHistory.
+func GetAuditHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	entry := models.History{}
+	models.Collection(models.HistoryCollection).FindOne(r.Context(), bson.M{"_id": id}).Decode(&entry)
+	if entry.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if entry.Collection == models.UserCollection {
+		if !helpers.HasPermission(r.Context(), enum.PermissionUserHistory) {
+			w.WriteHeader(403)
+			return
+		}
+		if !userInScope(w, r, entry.RecordID) {
+			return
+		}
+	}
+	render.JSON(w, r, responses.NewHistories([]models.History{entry})[0])
+}
+
+// VerifyAudit walks the audit chain and reports the first break, if any.
+func VerifyAudit(w http.ResponseWriter, r *http.Request) {
+	report, err := services.VerifyAudit(r.Context())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, report)
+}
+
+// ExportAudit downloads a segment of the audit chain, from and to being
+// sequence numbers, to be verified offline with the audit-verify command.
+func ExportAudit(w http.ResponseWriter, r *http.Request) {
+	from := helpers.StringToInt64(r.URL.Query().Get("from"), 1)
+	to := helpers.StringToInt64(r.URL.Query().Get("to"), 0)
+	buf := bytes.Buffer{}
+	err := services.ExportAudit(r.Context(), from, to, &buf)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
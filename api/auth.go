@@ -3,10 +3,12 @@ package api
 import (
 	"encoding/json"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
 	"github.com/anyshare/anyshare-common/mongodb"
 	"github.com/anyshare/anyshare-common/schemas"
 	"github.com/go-chi/render"
@@ -32,8 +34,8 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, formErrors)
 		return
 	}
-	user := schemas.User{}
-	mongodb.GetCollection(user).FindOne(r.Context(), bson.M{"email": strings.ToLower(form.Email)}).Decode(&user)
+	user := models.User{}
+	mongodb.GetCollection(user.User).FindOne(r.Context(), bson.M{"email": helpers.NormalizeEmail(form.Email)}).Decode(&user)
 	if user.ID.IsZero() {
 		w.WriteHeader(422)
 		render.JSON(w, r, render.M{"email": helpers.Translate(r.Context(), "accountNotExist")})
@@ -44,19 +46,30 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, render.M{"password": helpers.Translate(r.Context(), "wrongPassword")})
 		return
 	}
+	token, err := startSession(r, user)
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	render.JSON(w, r, responses.NewSession(r.Context(), token, user))
+}
+
+// startSession issues a token for the user and records the login.
+func startSession(r *http.Request, user models.User) (string, error) {
 	userToken := schemas.UserToken{
 		ID:         uuid.NewString(),
 		UserID:     user.ID,
 		UserAgent:  r.UserAgent(),
 		CreateTime: time.Now().Unix(),
 	}
-	result, err := mongodb.GetCollection(userToken).InsertOne(r.Context(), userToken)
-	if result == nil || err != nil {
-		w.WriteHeader(500)
-		return
+	_, err := mongodb.GetCollection(userToken).InsertOne(r.Context(), userToken)
+	if err != nil {
+		return "", err
 	}
-	render.JSON(w, r, render.M{
-		"token": result.InsertedID,
-		"user":  user,
+	services.SetAuditActor(r.Context(), user.ID)
+	// Not a change of the user, so the version is left alone.
+	_, err = mongodb.GetCollection(user.User).UpdateOne(r.Context(), bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"lastLoginTime": userToken.CreateTime},
 	})
+	return userToken.ID, err
 }
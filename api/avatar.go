@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-admin-api/storage"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const maxAvatarBytes = 5 << 20
+
+func UploadProfileAvatar(w http.ResponseWriter, r *http.Request) {
+	uploadAvatar(w, r, r.Context().Value(enum.ContextKeyUser).(schemas.User).ID)
+}
+
+func UploadUserAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !userInScope(w, r, id) {
+		return
+	}
+	uploadAvatar(w, r, id)
+}
+
+// uploadAvatar reads the "avatar" multipart file, stores its processed
+// variants and replaces the previous ones.
+func uploadAvatar(w http.ResponseWriter, r *http.Request, id primitive.ObjectID) {
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
+	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
+	if user.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBytes+1<<10)
+	file, _, err := r.FormFile("avatar")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		w.WriteHeader(413)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"avatar": helpers.Translate(r.Context(), "invalidImage")})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxAvatarBytes+1))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if len(data) > maxAvatarBytes {
+		w.WriteHeader(413)
+		return
+	}
+
+	hash, variants, err := services.ProcessAvatar(data)
+	if errors.Is(err, services.ErrUnsupportedImage) {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"avatar": helpers.Translate(r.Context(), "invalidImage")})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	avatar := models.Avatar{Hash: hash, UpdateTime: time.Now().Unix()}
+	// Variants written for an upload that does not make it are deleted,
+	// unless they are those of the current avatar, uploaded again.
+	abort := func() {
+		if user.Avatar == nil || user.Avatar.Hash != hash {
+			deleteAvatar(r, id, hash, avatar.Sizes)
+		}
+	}
+	for _, variant := range variants {
+		err := storage.Default().Put(r.Context(), models.AvatarKey(id, hash, variant.Size), variant.Data, variant.ContentType)
+		if err != nil {
+			avatar.Sizes = append(avatar.Sizes, variant.Size)
+			abort()
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		avatar.Sizes = append(avatar.Sizes, variant.Size)
+	}
+
+	result, err := helpers.UpdateVersion(r.Context(), db, id, user.Version, bson.M{"$set": bson.M{"avatar": avatar}})
+	if err != nil {
+		abort()
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if result.MatchedCount == 0 {
+		abort()
+		w.WriteHeader(412)
+		return
+	}
+	if user.Avatar != nil && user.Avatar.Hash != hash {
+		deleteAvatar(r, id, user.Avatar.Hash, user.Avatar.Sizes)
+	}
+	renderUser(w, r, id)
+}
+
+// deleteAvatar deletes the stored variants of an avatar, logging failures.
+func deleteAvatar(r *http.Request, userID primitive.ObjectID, hash string, sizes []int) {
+	for _, size := range sizes {
+		err := storage.Default().Delete(r.Context(), models.AvatarKey(userID, hash, size))
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Println("delete avatar:", err)
+		}
+	}
+}
+
+// GetAvatar serves a stored avatar variant. Variant keys are content
+// addressed, so responses are cacheable forever.
+func GetAvatar(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+	size, err := strconv.Atoi(chi.URLParam(r, "size"))
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+	hash := chi.URLParam(r, "hash")
+	etag := `"` + hash + "-" + strconv.Itoa(size) + `"`
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(304)
+		return
+	}
+	data, err := storage.Default().Get(r.Context(), models.AvatarKey(id, hash, size))
+	if errors.Is(err, storage.ErrNotFound) {
+		w.Header().Del("Cache-Control")
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", mimetype.Detect(data).String())
+	w.Write(data)
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListGrant lists role grants, optionally of one admin (adminId) and in one
+// status: scheduled, active, expired or revoked.
+func ListGrant(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	now := time.Now().Unix()
+	filter := services.GrantFilter(r.URL.Query().Get("status"), now)
+	if value := r.URL.Query().Get("adminId"); value != "" {
+		adminID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		filter["adminId"] = adminID
+	}
+	db := models.Collection(models.GrantCollection)
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "startTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	grants := []models.Grant{}
+	err = cursor.All(r.Context(), &grants)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"items":     responses.NewGrants(grants, now),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// grantHistoryFields are the fields of a grant tracked by the change history.
+func grantHistoryFields(grant models.Grant) bson.M {
+	return bson.M{
+		"role":       grant.Role,
+		"startTime":  grant.StartTime,
+		"endTime":    grant.EndTime,
+		"revokeTime": grant.RevokeTime,
+	}
+}
+
+func recordGrantHistory(r *http.Request, grant models.Grant, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.GrantCollection, grant.ID, action, grantHistoryFields(grant), update)
+	if err != nil {
+		log.Println("record grant history:", err)
+	}
+}
+
+// CreateGrant gives the admin in the "id" URL parameter a role for a limited
+// time, starting now unless startTime is given.
+func CreateGrant(w http.ResponseWriter, r *http.Request) {
+	admin, ok := findActiveAdmin(w, r)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Role          string `json:"role" validate:"required,role"`
+		Justification string `json:"justification" validate:"required,max=1000"`
+		StartTime     int64  `json:"startTime" validate:"gte=0"`
+		EndTime       int64  `json:"endTime" validate:"required"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	now := time.Now().Unix()
+	if form.StartTime == 0 {
+		form.StartTime = now
+	}
+	maxDuration := services.GrantMaxDuration()
+	switch {
+	case form.EndTime <= form.StartTime || form.EndTime <= now:
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"endTime": helpers.Translate(r.Context(), "grantEndTime")})
+		return
+	case form.EndTime-form.StartTime > int64(maxDuration.Seconds()):
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"endTime": helpers.Translate(r.Context(), "grantTooLong", strconv.FormatFloat(maxDuration.Hours(), 'f', -1, 64))})
+		return
+	}
+	if !services.CanAssignRoles(r.Context(), []string{form.Role}) {
+		w.WriteHeader(403)
+		return
+	}
+	if services.GainsPermissions(r.Context(), admin.Roles, []string{form.Role}) && requireApproval(w, r, "CreateGrant", models.Approval{
+		Action:     models.ApprovalRoleEscalation,
+		Permission: enum.PermissionAdminWrite,
+		Roles:      []string{form.Role},
+		TargetID:   admin.ID,
+	}, form) {
+		return
+	}
+
+	grant := models.Grant{
+		AdminID:       admin.ID,
+		Role:          form.Role,
+		Justification: form.Justification,
+		StartTime:     form.StartTime,
+		EndTime:       form.EndTime,
+		CreateTime:    now,
+	}
+	if actor, ok := r.Context().Value(enum.ContextKeyUser).(schemas.User); ok {
+		grant.GrantedBy = actor.ID
+	}
+	result, err := models.Collection(models.GrantCollection).InsertOne(r.Context(), grant)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	grant.ID = result.InsertedID.(primitive.ObjectID)
+	recordGrantHistory(r, models.Grant{ID: grant.ID}, services.HistoryActionCreate, grantHistoryFields(grant))
+	render.JSON(w, r, responses.NewGrant(grant, now))
+}
+
+// RevokeGrant ends a scheduled or active grant early.
+func RevokeGrant(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	db := models.Collection(models.GrantCollection)
+	grant := models.Grant{}
+	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&grant)
+	if grant.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if !services.CanAssignRoles(r.Context(), []string{grant.Role}) {
+		w.WriteHeader(403)
+		return
+	}
+	now := time.Now().Unix()
+	update := bson.M{"revokeTime": now}
+	if actor, ok := r.Context().Value(enum.ContextKeyUser).(schemas.User); ok {
+		update["revokedBy"] = actor.ID
+	}
+	result, err := db.UpdateOne(r.Context(), bson.M{"_id": id, "revokeTime": nil, "endTime": bson.M{"$gt": now}}, bson.M{"$set": update})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if result.MatchedCount == 0 {
+		w.WriteHeader(409)
+		return
+	}
+	recordGrantHistory(r, grant, services.HistoryActionDelete, bson.M{"revokeTime": now})
+	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&grant)
+	render.JSON(w, r, responses.NewGrant(grant, now))
+}
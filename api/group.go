@@ -0,0 +1,440 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func ListGroup(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	filter := bson.M{}
+	db := models.Collection(models.GroupCollection)
+
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "name", Value: 1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	groups := []models.Group{}
+	err = cursor.All(r.Context(), &groups)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	items := make([]responses.Group, 0, len(groups))
+	for _, group := range groups {
+		memberCount, err := groupMemberCount(r, group.ID)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		items = append(items, responses.NewGroup(group, memberCount))
+	}
+
+	render.JSON(w, r, render.M{
+		"items":     items,
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+func groupMemberCount(r *http.Request, id primitive.ObjectID) (int64, error) {
+	return mongodb.GetCollection(schemas.User{}).CountDocuments(r.Context(), bson.M{"groupIds": id, "deleteTime": nil})
+}
+
+// findGroup loads the group in the "id" URL parameter, writing the error
+// response and returning false when there is none.
+func findGroup(w http.ResponseWriter, r *http.Request) (models.Group, bool) {
+	group := models.Group{}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return group, false
+	}
+	models.Collection(models.GroupCollection).FindOne(r.Context(), bson.M{"_id": id}).Decode(&group)
+	if group.ID.IsZero() {
+		w.WriteHeader(404)
+		return group, false
+	}
+	return group, true
+}
+
+func renderGroup(w http.ResponseWriter, r *http.Request, group models.Group) {
+	memberCount, err := groupMemberCount(r, group.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewGroup(group, memberCount))
+}
+
+func GetGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(w, r)
+	if !ok {
+		return
+	}
+	renderGroup(w, r, group)
+}
+
+func groupHistoryFields(group models.Group) bson.M {
+	return bson.M{
+		"name": group.Name,
+		"desc": group.Desc,
+	}
+}
+
+func recordGroupHistory(r *http.Request, group models.Group, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.GroupCollection, group.ID, action, groupHistoryFields(group), update)
+	if err != nil {
+		log.Println("record group history:", err)
+	}
+}
+
+// groupNameTaken reports whether another group than id already has the name.
+func groupNameTaken(r *http.Request, name string, id primitive.ObjectID) (bool, error) {
+	count, err := models.Collection(models.GroupCollection).CountDocuments(r.Context(), bson.M{
+		"name": name,
+		"_id":  bson.M{"$ne": id},
+	})
+	return count > 0, err
+}
+
+func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Name string `json:"name" validate:"required,max=50"`
+		Desc string `json:"desc" validate:"max=1000"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	taken, err := groupNameTaken(r, form.Name, primitive.NilObjectID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if taken {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"name": helpers.Translate(r.Context(), "groupNameTaken")})
+		return
+	}
+	now := time.Now().Unix()
+	group := models.Group{Name: form.Name, Desc: form.Desc, CreateTime: now, UpdateTime: now}
+	result, err := models.Collection(models.GroupCollection).InsertOne(r.Context(), group)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	group.ID = result.InsertedID.(primitive.ObjectID)
+	recordGroupHistory(r, models.Group{ID: group.ID}, services.HistoryActionCreate, groupHistoryFields(group))
+	renderGroup(w, r, group)
+}
+
+func UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(w, r)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Name string `json:"name" validate:"required,max=50"`
+		Desc string `json:"desc" validate:"max=1000"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	taken, err := groupNameTaken(r, form.Name, group.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if taken {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"name": helpers.Translate(r.Context(), "groupNameTaken")})
+		return
+	}
+	before := group
+	group.Name = form.Name
+	group.Desc = form.Desc
+	group.UpdateTime = time.Now().Unix()
+	_, err = models.Collection(models.GroupCollection).UpdateOne(r.Context(), bson.M{"_id": group.ID}, bson.M{"$set": bson.M{
+		"name":       group.Name,
+		"desc":       group.Desc,
+		"updateTime": group.UpdateTime,
+	}})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordGroupHistory(r, before, services.HistoryActionUpdate, groupHistoryFields(group))
+	renderGroup(w, r, group)
+}
+
+// DeleteGroup removes the group from its members before deleting it, so no
+// user is left pointing at a missing group.
+// DeleteGroup deletes a group and takes every member out of it, in or out of
+// the caller's scope, in one transaction so that no user is left pointing at
+// it.
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(w, r)
+	if !ok {
+		return
+	}
+	users := mongodb.GetCollection(schemas.User{})
+	session, err := users.Database().Client().StartSession()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	defer session.EndSession(r.Context())
+
+	members := []models.User{}
+	_, err = session.WithTransaction(r.Context(), func(ctx mongo.SessionContext) (interface{}, error) {
+		cursor, err := users.Find(ctx, bson.M{"groupIds": group.ID})
+		if err != nil {
+			return nil, err
+		}
+		members = []models.User{}
+		err = cursor.All(ctx, &members)
+		if err != nil {
+			return nil, err
+		}
+		_, err = users.UpdateMany(ctx, bson.M{"groupIds": group.ID}, bson.M{
+			"$pull": bson.M{"groupIds": group.ID},
+			"$inc":  bson.M{"version": 1},
+		})
+		if err != nil {
+			return nil, err
+		}
+		return models.Collection(models.GroupCollection).DeleteOne(ctx, bson.M{"_id": group.ID})
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	for _, user := range members {
+		recordUserHistory(r, user, services.HistoryActionUpdate, withoutGroup(user, group.ID))
+	}
+	recordGroupHistory(r, group, services.HistoryActionDelete, groupHistoryFields(models.Group{}))
+	w.WriteHeader(204)
+}
+
+func withoutGroup(user models.User, id primitive.ObjectID) bson.M {
+	if !slices.Contains(user.GroupIDs, id) {
+		return nil
+	}
+	groupIDs := slices.DeleteFunc(slices.Clone(user.GroupIDs), func(groupID primitive.ObjectID) bool {
+		return groupID == id
+	})
+	return bson.M{"groupIds": groupIDs}
+}
+
+func AddGroupMember(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(w, r)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		UserIDs []primitive.ObjectID `json:"userIds" validate:"required,max=1000"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	filter := bson.M{"_id": bson.M{"$in": form.UserIDs}}
+	updated, err := updateUsers(r, filter, services.HistoryActionUpdate, func(user models.User) bson.M {
+		if slices.Contains(user.GroupIDs, group.ID) {
+			return nil
+		}
+		return bson.M{"groupIds": append(slices.Clone(user.GroupIDs), group.ID)}
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{"updated": updated})
+}
+
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(w, r)
+	if !ok {
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "userId"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	updated, err := updateUsers(r, bson.M{"_id": userID, "groupIds": group.ID}, services.HistoryActionUpdate, func(user models.User) bson.M {
+		return withoutGroup(user, group.ID)
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if updated == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	w.WriteHeader(204)
+}
+
+// Actions GroupAction can apply to the members of a group.
+const (
+	GroupActionDelete    = "delete"
+	GroupActionAddTag    = "addTag"
+	GroupActionRemoveTag = "removeTag"
+)
+
+// GroupAction applies an action to the members of a group. The members can
+// be narrowed with the query parameters of ListUser.
+func GroupAction(w http.ResponseWriter, r *http.Request) {
+	group, ok := findGroup(w, r)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Action string `json:"action" validate:"required,oneof=delete addTag removeTag"`
+		Tag    string `json:"tag" validate:"required_unless=Action delete,max=50"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	if form.Action == GroupActionDelete && !helpers.HasPermission(r.Context(), enum.PermissionUserDelete) {
+		w.WriteHeader(403)
+		return
+	}
+	if form.Action == GroupActionDelete && requireApproval(w, r, "GroupAction", models.Approval{
+		Action:     models.ApprovalUserBulkDelete,
+		Permission: enum.PermissionUserDelete,
+		TargetID:   group.ID,
+	}, form) {
+		return
+	}
+	filter, search, err := userListFilter(r.Context(), r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	filter["groupIds"] = group.ID
+	if !search.IsEmpty() {
+		filter["$and"] = search.Conditions("")
+	}
+
+	action := services.HistoryActionUpdate
+	tags := helpers.NormalizeTags([]string{form.Tag})
+	var change func(user models.User) bson.M
+	switch form.Action {
+	case GroupActionDelete:
+		action = services.HistoryActionDelete
+		deleteTime := time.Now().Unix()
+		change = func(user models.User) bson.M {
+			if user.DeleteTime > 0 {
+				return nil
+			}
+			return bson.M{"deleteTime": deleteTime}
+		}
+	case GroupActionAddTag:
+		change = func(user models.User) bson.M {
+			if len(tags) == 0 || slices.Contains(user.Tags, tags[0]) {
+				return nil
+			}
+			return bson.M{"tags": append(slices.Clone(user.Tags), tags[0])}
+		}
+	case GroupActionRemoveTag:
+		change = func(user models.User) bson.M {
+			if len(tags) == 0 || !slices.Contains(user.Tags, tags[0]) {
+				return nil
+			}
+			return bson.M{"tags": slices.DeleteFunc(slices.Clone(user.Tags), func(tag string) bool {
+				return tag == tags[0]
+			})}
+		}
+	}
+	updated, err := updateUsers(r, filter, action, change)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{"updated": updated})
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userInScope reports whether the user with id is in the scope of the current
+// admin, writing a 404 response, as for a missing user, when it is not.
+func userInScope(w http.ResponseWriter, r *http.Request, id primitive.ObjectID) bool {
+	if services.ScopeFilter(r.Context()) == nil {
+		return true
+	}
+	count, err := mongodb.GetCollection(schemas.User{}).CountDocuments(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id}))
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return false
+	}
+	if count == 0 {
+		w.WriteHeader(404)
+		return false
+	}
+	return true
+}
+
+func ListUserHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !userInScope(w, r, id) {
+		return
+	}
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	filter := bson.M{"collection": models.UserCollection, "recordId": id}
+	db := models.Collection(models.HistoryCollection)
+
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	entries := []models.History{}
+	err = cursor.All(r.Context(), &entries)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	render.JSON(w, r, render.M{
+		"items":     responses.NewHistories(entries),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// GetUserSnapshot shows a user as it was at the unix time given in "time".
+func GetUserSnapshot(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	at := helpers.StringToInt64(r.URL.Query().Get("time"), 0)
+	if at <= 0 {
+		w.WriteHeader(400)
+		return
+	}
+	current := bson.M{}
+	mongodb.GetCollection(schemas.User{}).FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&current)
+	if len(current) == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	record, err := services.RecordAsOf(r.Context(), models.UserCollection, current, at)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	user := models.User{}
+	data, err := bson.Marshal(record)
+	if err == nil {
+		err = bson.Unmarshal(data, &user)
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if user.JoinTime > at {
+		w.WriteHeader(404)
+		return
+	}
+	render.JSON(w, r, responses.NewUser(r.Context(), user))
+}
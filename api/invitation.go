@@ -0,0 +1,469 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/mail"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	errInvitationInvalid  = errors.New("invitation is invalid, used, revoked or expired")
+	errInvitationProfile  = errors.New("invitation for a new user needs a full name")
+	errInvitationConflict = errors.New("user changed while accepting the invitation")
+)
+
+// invitationTTL reads INVITE_TTL as a duration such as "72h", the default.
+func invitationTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("INVITE_TTL"))
+	if err != nil || ttl <= 0 {
+		return 72 * time.Hour
+	}
+	return ttl
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// invitationHistoryFields leaves out the email, which history would keep
+// after the invitee is erased.
+func invitationHistoryFields(invitation models.Invitation) bson.M {
+	roles := invitation.Roles
+	if roles == nil {
+		roles = []string{}
+	}
+	return bson.M{
+		"roles":      roles,
+		"sendCount":  invitation.SendCount,
+		"expireTime": invitation.ExpireTime,
+		"acceptTime": invitation.AcceptTime,
+		"revokeTime": invitation.RevokeTime,
+		"userId":     invitation.UserID,
+	}
+}
+
+func recordInvitationHistory(r *http.Request, invitation models.Invitation, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.InvitationCollection, invitation.ID, action, invitationHistoryFields(invitation), update)
+	if err != nil {
+		log.Println("record invitation history:", err)
+	}
+}
+
+// sendInvitation issues a new token for the invitation, which replaces any
+// previous one, and emails it in the locale of the invitation.
+func sendInvitation(r *http.Request, invitation *models.Invitation) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	now := time.Now()
+	before := *invitation
+	invitation.TokenHash = hashInvitationToken(token)
+	invitation.SendCount++
+	invitation.SendTime = now.Unix()
+	invitation.ExpireTime = now.Add(invitationTTL()).Unix()
+
+	_, err := models.Collection(models.InvitationCollection).UpdateOne(r.Context(), bson.M{"_id": invitation.ID}, bson.M{"$set": bson.M{
+		"tokenHash":  invitation.TokenHash,
+		"sendCount":  invitation.SendCount,
+		"sendTime":   invitation.SendTime,
+		"expireTime": invitation.ExpireTime,
+	}})
+	if err != nil {
+		return err
+	}
+	recordInvitationHistory(r, before, services.HistoryActionUpdate, invitationHistoryFields(*invitation))
+	link := os.Getenv("INVITE_URL") + token
+	expires := time.Unix(invitation.ExpireTime, 0).UTC().Format("2006-01-02 15:04 MST")
+	return mail.Default().Send(r.Context(), mail.Message{
+		To:      invitation.Email,
+		Subject: helpers.TranslateLocale(invitation.Locale, "inviteSubject"),
+		Body:    helpers.TranslateLocale(invitation.Locale, "inviteBody", link, expires),
+	})
+}
+
+func ListInvitation(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	now := time.Now().Unix()
+	filter := bson.M{}
+	if r.URL.Query().Get("status") == responses.InvitationPending {
+		filter = bson.M{"acceptTime": nil, "revokeTime": nil, "expireTime": bson.M{"$gt": now}}
+	}
+	db := models.Collection(models.InvitationCollection)
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	invitations := []models.Invitation{}
+	err = cursor.All(r.Context(), &invitations)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"items":     responses.NewInvitations(invitations, now),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// InviteAdmin emails an invitation to become admin with the given roles.
+func InviteAdmin(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Email  string   `json:"email" validate:"required,email"`
+		Roles  []string `json:"roles" validate:"required,min=1,unique,dive,role"`
+		Locale string   `json:"locale" validate:"omitempty,oneof=en vi"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	form.Email = helpers.NormalizeEmail(form.Email)
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	if !services.CanAssignRoles(r.Context(), form.Roles) {
+		w.WriteHeader(403)
+		return
+	}
+	if form.Locale == "" {
+		form.Locale = helpers.Locale(r.Context())
+	}
+
+	user := models.User{}
+	mongodb.GetCollection(user.User).FindOne(r.Context(), bson.M{"email": form.Email}).Decode(&user)
+	if !user.ID.IsZero() {
+		count, err := models.Collection(models.AdminCollection).CountDocuments(r.Context(), bson.M{"userId": user.ID, "deleteTime": nil})
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if count > 0 {
+			w.WriteHeader(422)
+			render.JSON(w, r, render.M{"email": helpers.Translate(r.Context(), "alreadyAdmin")})
+			return
+		}
+	}
+	db := models.Collection(models.InvitationCollection)
+	now := time.Now().Unix()
+	count, err := db.CountDocuments(r.Context(), bson.M{
+		"email":      form.Email,
+		"acceptTime": nil,
+		"revokeTime": nil,
+		"expireTime": bson.M{"$gt": now},
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if count > 0 {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"email": helpers.Translate(r.Context(), "invitationPending")})
+		return
+	}
+
+	if services.GainsPermissions(r.Context(), nil, form.Roles) && requireApproval(w, r, "InviteAdmin", models.Approval{
+		Action:     models.ApprovalRoleEscalation,
+		Permission: enum.PermissionAdminWrite,
+		Roles:      form.Roles,
+	}, form) {
+		return
+	}
+	invitation := models.Invitation{
+		Email:      form.Email,
+		Roles:      form.Roles,
+		Locale:     form.Locale,
+		CreateTime: now,
+	}
+	if actor, ok := r.Context().Value(enum.ContextKeyUser).(schemas.User); ok {
+		invitation.InvitedBy = actor.ID
+	}
+	result, err := db.InsertOne(r.Context(), invitation)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	invitation.ID = result.InsertedID.(primitive.ObjectID)
+	recordInvitationHistory(r, models.Invitation{ID: invitation.ID}, services.HistoryActionCreate, invitationHistoryFields(invitation))
+	err = sendInvitation(r, &invitation)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewInvitation(invitation, now))
+}
+
+// findOpenInvitation loads the invitation in the "id" URL parameter, writing
+// the error response and returning false unless it is neither accepted nor
+// revoked. Expired invitations can still be resent.
+func findOpenInvitation(w http.ResponseWriter, r *http.Request) (models.Invitation, bool) {
+	invitation := models.Invitation{}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return invitation, false
+	}
+	models.Collection(models.InvitationCollection).FindOne(r.Context(), bson.M{"_id": id}).Decode(&invitation)
+	if invitation.ID.IsZero() {
+		w.WriteHeader(404)
+		return invitation, false
+	}
+	if invitation.AcceptTime > 0 || invitation.RevokeTime > 0 {
+		w.WriteHeader(409)
+		return invitation, false
+	}
+	if !services.CanAssignRoles(r.Context(), invitation.Roles) {
+		w.WriteHeader(403)
+		return invitation, false
+	}
+	return invitation, true
+}
+
+// ResendInvitation emails a fresh token, the previous one stops working and
+// the expiry starts over.
+func ResendInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := findOpenInvitation(w, r)
+	if !ok {
+		return
+	}
+	err := sendInvitation(r, &invitation)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewInvitation(invitation, time.Now().Unix()))
+}
+
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	invitation, ok := findOpenInvitation(w, r)
+	if !ok {
+		return
+	}
+	before := invitation
+	invitation.RevokeTime = time.Now().Unix()
+	_, err := models.Collection(models.InvitationCollection).UpdateOne(r.Context(), bson.M{"_id": invitation.ID, "acceptTime": nil}, bson.M{
+		"$set": bson.M{"revokeTime": invitation.RevokeTime},
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordInvitationHistory(r, before, services.HistoryActionUpdate, bson.M{"revokeTime": invitation.RevokeTime})
+	render.JSON(w, r, responses.NewInvitation(invitation, invitation.RevokeTime))
+}
+
+// AcceptInvitation redeems an invitation token. In one transaction it marks
+// the invitation used, creates the user or sets the password of the existing
+// one, and grants the roles. The new admin is logged in.
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required,min=7,max=50"`
+		FullName string `json:"fullName" validate:"max=50"`
+		Address  string `json:"address" validate:"max=250"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte(form.Password), 10)
+
+	users := mongodb.GetCollection(schemas.User{})
+	invitations := models.Collection(models.InvitationCollection)
+	admins := models.Collection(models.AdminCollection)
+	session, err := users.Database().Client().StartSession()
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	defer session.EndSession(r.Context())
+
+	var (
+		invitation models.Invitation
+		user       models.User
+		admin      models.Admin
+		roles      []string
+		created    bool
+		acceptTime int64
+	)
+	_, err = session.WithTransaction(r.Context(), func(ctx mongo.SessionContext) (interface{}, error) {
+		invitation, user, admin, roles, created = models.Invitation{}, models.User{}, models.Admin{}, nil, false
+		now := time.Now().Unix()
+		acceptTime = now
+		err := invitations.FindOneAndUpdate(ctx, bson.M{
+			"tokenHash":  hashInvitationToken(form.Token),
+			"acceptTime": nil,
+			"revokeTime": nil,
+			"expireTime": bson.M{"$gt": now},
+		}, bson.M{"$set": bson.M{"acceptTime": now}}).Decode(&invitation)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errInvitationInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		users.FindOne(ctx, bson.M{"email": invitation.Email}).Decode(&user)
+		switch {
+		case user.ID.IsZero():
+			if form.FullName == "" {
+				return nil, errInvitationProfile
+			}
+			created = true
+			user.User = schemas.User{
+				Email:    invitation.Email,
+				Password: string(hash),
+				FullName: form.FullName,
+				Address:  form.Address,
+				JoinTime: now,
+			}
+			result, err := users.InsertOne(ctx, services.SearchableUser(user))
+			if err != nil {
+				return nil, err
+			}
+			user.ID = result.InsertedID.(primitive.ObjectID)
+		case user.DeleteTime > 0:
+			return nil, errInvitationInvalid
+		default:
+			result, err := helpers.UpdateVersion(ctx, users, user.ID, user.Version, bson.M{"$set": bson.M{"password": string(hash)}})
+			if err != nil {
+				return nil, err
+			}
+			if result.MatchedCount == 0 {
+				return nil, errInvitationConflict
+			}
+		}
+
+		admins.FindOne(ctx, bson.M{"userId": user.ID, "deleteTime": nil}).Decode(&admin)
+		if admin.ID.IsZero() {
+			roles = invitation.Roles
+			result, err := admins.InsertOne(ctx, models.Admin{UserID: user.ID, Roles: roles, JoinTime: now})
+			if mongo.IsDuplicateKeyError(err) {
+				return nil, errInvitationConflict
+			}
+			if err != nil {
+				return nil, err
+			}
+			admin.ID = result.InsertedID.(primitive.ObjectID)
+		} else {
+			roles = slices.Clone(admin.Roles)
+			for _, role := range invitation.Roles {
+				if !slices.Contains(roles, role) {
+					roles = append(roles, role)
+				}
+			}
+			result, err := helpers.UpdateVersion(ctx, admins, admin.ID, admin.Version, bson.M{"$set": bson.M{"roles": roles}})
+			if err != nil {
+				return nil, err
+			}
+			if result.MatchedCount == 0 {
+				return nil, errInvitationConflict
+			}
+		}
+		_, err = invitations.UpdateOne(ctx, bson.M{"_id": invitation.ID}, bson.M{"$set": bson.M{"userId": user.ID}})
+		return nil, err
+	})
+	switch {
+	case errors.Is(err, errInvitationInvalid):
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"token": helpers.Translate(r.Context(), "invitationInvalid")})
+		return
+	case errors.Is(err, errInvitationProfile):
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"fullName": helpers.Translate(r.Context(), "invitationProfileRequired")})
+		return
+	case errors.Is(err, errInvitationConflict):
+		w.WriteHeader(409)
+		return
+	case err != nil:
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	ctx := r.Context()
+	recordInvitationHistory(r, invitation, services.HistoryActionUpdate, bson.M{"acceptTime": acceptTime, "userId": user.ID})
+	if created {
+		recordUserHistory(r, models.User{User: schemas.User{ID: user.ID}}, services.HistoryActionCreate, bson.M{"fullName": user.FullName, "address": user.Address})
+	} else {
+		recordUserHistory(r, user, services.HistoryActionPassword, bson.M{"password": string(hash)})
+	}
+	if admin.UserID.IsZero() {
+		recordAdminHistory(r, models.Admin{ID: admin.ID}, services.HistoryActionCreate, bson.M{"roles": roles})
+	} else {
+		recordAdminHistory(r, admin, services.HistoryActionUpdate, bson.M{"roles": roles})
+	}
+
+	mongodb.GetCollection(user.User).FindOne(ctx, bson.M{"_id": user.ID}).Decode(&user)
+	token, err := startSession(r, user)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewSession(ctx, token, user))
+}
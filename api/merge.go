@@ -0,0 +1,664 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	errMergeConflict     = errors.New("user changed since the merge")
+	errMergePrecondition = errors.New("user changed before the merge")
+)
+
+func ListDuplicate(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	// Scoped admins only see candidates whose users are all in their scope.
+	pipeline := append(services.ScopeStages(r.Context(), "userIds"), bson.M{"$facet": bson.M{
+		"items": bson.A{
+			bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "_id", Value: 1}}},
+			bson.M{"$skip": skip},
+			bson.M{"$limit": pageSize},
+		},
+		"count": bson.A{bson.M{"$count": "count"}},
+	}})
+	cursor, err := models.Collection(models.DuplicateCollection).Aggregate(r.Context(), pipeline)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	facets := []struct {
+		Items []models.DuplicateCandidate `bson:"items"`
+		Count []struct {
+			Count int64 `bson:"count"`
+		} `bson:"count"`
+	}{}
+	err = cursor.All(r.Context(), &facets)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	candidates := []models.DuplicateCandidate{}
+	count := int64(0)
+	if len(facets) > 0 {
+		candidates = append(candidates, facets[0].Items...)
+		if len(facets[0].Count) > 0 {
+			count = facets[0].Count[0].Count
+		}
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	ids := []primitive.ObjectID{}
+	for _, candidate := range candidates {
+		ids = append(ids, candidate.UserIDs...)
+	}
+	cursor, err = mongodb.GetCollection(schemas.User{}).Find(r.Context(), bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	users := []models.User{}
+	err = cursor.All(r.Context(), &users)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	byID := map[primitive.ObjectID]responses.User{}
+	for _, user := range responses.NewUsers(r.Context(), users) {
+		byID[user.ID] = user
+	}
+
+	items := make([]responses.DuplicateCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		item := responses.DuplicateCandidate{
+			ID:         candidate.ID,
+			Users:      []responses.User{},
+			Reasons:    candidate.Reasons,
+			Score:      candidate.Score,
+			DetectTime: candidate.DetectTime,
+		}
+		for _, id := range candidate.UserIDs {
+			if user, ok := byID[id]; ok {
+				item.Users = append(item.Users, user)
+			}
+		}
+		items = append(items, item)
+	}
+	render.JSON(w, r, render.M{
+		"items":     items,
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// findUserDocument loads a user in the scope of the current admin both as a
+// raw document, kept as the merge snapshot, and decoded.
+func findUserDocument(r *http.Request, id primitive.ObjectID) (bson.M, models.User, error) {
+	doc := bson.M{}
+	user := models.User{}
+	err := mongodb.GetCollection(schemas.User{}).FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&doc)
+	if err != nil {
+		return nil, user, err
+	}
+	data, err := bson.Marshal(doc)
+	if err == nil {
+		err = bson.Unmarshal(data, &user)
+	}
+	return doc, user, err
+}
+
+// findAdminDocument loads the active admin record of a user both as a raw
+// document, kept as the merge snapshot, and decoded. The document is nil when
+// the user is no admin.
+func findAdminDocument(r *http.Request, userID primitive.ObjectID) (bson.M, models.Admin, error) {
+	doc := bson.M{}
+	admin := models.Admin{}
+	err := models.Collection(models.AdminCollection).FindOne(r.Context(), bson.M{"userId": userID, "deleteTime": nil}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, admin, nil
+	}
+	if err != nil {
+		return nil, admin, err
+	}
+	data, err := bson.Marshal(doc)
+	if err == nil {
+		err = bson.Unmarshal(data, &admin)
+	}
+	return doc, admin, err
+}
+
+// newMerge records the merge of source into target, taking fields from the
+// user each names, along with their documents as they were. Snapshots leave
+// password hashes out, only the one the merge replaces is kept to revert it.
+func newMerge(source models.User, target models.User, sourceDoc bson.M, targetDoc bson.M, fields map[string]string, now int64) models.Merge {
+	delete(sourceDoc, "password")
+	delete(targetDoc, "password")
+	merge := models.Merge{
+		SourceID:      source.ID,
+		TargetID:      target.ID,
+		Fields:        fields,
+		Source:        sourceDoc,
+		Target:        targetDoc,
+		SourceVersion: source.Version + 1,
+		TargetVersion: target.Version + 1,
+		CreateTime:    now,
+	}
+	if fields["password"] == "source" {
+		merge.ReplacedPassword = target.Password
+	}
+	return merge
+}
+
+// restoreUser replaces a user with a snapshot if it is still at version,
+// bumping the version past it. Snapshots leave the password out, the one
+// given is kept instead.
+func restoreUser(ctx context.Context, doc bson.M, version int64, password interface{}) error {
+	restored := bson.M{}
+	for key, value := range doc {
+		restored[key] = value
+	}
+	if _, ok := restored["password"]; !ok && password != nil {
+		restored["password"] = password
+	}
+	restored["version"] = version + 1
+	result, err := mongodb.GetCollection(schemas.User{}).ReplaceOne(ctx, bson.M{"_id": doc["_id"], "version": version}, restored)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errMergeConflict
+	}
+	return nil
+}
+
+// restoreAdmin replaces an admin record with a snapshot if it is still at
+// the version the merge left it at, one past the snapshot.
+func restoreAdmin(ctx context.Context, doc bson.M, version int64) error {
+	restored := bson.M{}
+	for key, value := range doc {
+		restored[key] = value
+	}
+	restored["version"] = version + 2
+	result, err := models.Collection(models.AdminCollection).ReplaceOne(ctx, bson.M{"_id": doc["_id"], "version": version + 1}, restored)
+	if mongo.IsDuplicateKeyError(err) {
+		return errMergeConflict
+	}
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errMergeConflict
+	}
+	return nil
+}
+
+// MergeUser merges the source user into the target one. Fields picks, for
+// each of email, password, fullName, address and desc, the user whose value
+// is kept (the target by default). Tags, groups and attributes are combined,
+// sessions and admin records move to the target and the source is deleted.
+func MergeUser(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		SourceID string            `json:"sourceId" validate:"required"`
+		TargetID string            `json:"targetId" validate:"required,nefield=SourceID"`
+		Fields   map[string]string `json:"fields" validate:"dive,keys,oneof=email password fullName address desc,endkeys,oneof=source target"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	sourceID, err := primitive.ObjectIDFromHex(form.SourceID)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	targetID, err := primitive.ObjectIDFromHex(form.TargetID)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sourceDoc, source, err := findUserDocument(r, sourceID)
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+	targetDoc, target, err := findUserDocument(r, targetID)
+	if err != nil {
+		w.WriteHeader(404)
+		return
+	}
+	if source.DeleteTime > 0 || target.DeleteTime > 0 {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"sourceId": helpers.Translate(r.Context(), "mergeDeletedUser")})
+		return
+	}
+	if helpers.PreconditionFailed(w, r, target.Version) {
+		return
+	}
+
+	now := time.Now().Unix()
+	fromSource := func(field string) bool {
+		return form.Fields[field] == "source"
+	}
+	merged := target
+	updateData := bson.M{}
+	if fromSource("email") {
+		merged.Email = source.Email
+		updateData["email"] = source.Email
+	}
+	if fromSource("password") {
+		updateData["password"] = source.Password
+	}
+	if fromSource("fullName") {
+		merged.FullName = source.FullName
+		updateData["fullName"] = source.FullName
+	}
+	if fromSource("address") {
+		merged.Address = source.Address
+		updateData["address"] = source.Address
+	}
+	if fromSource("desc") {
+		updateData["desc"] = source.Desc
+	}
+	updateData["search"] = services.UserSearchFields(merged.Email, merged.FullName, merged.Address)
+	tags := slices.Clone(target.Tags)
+	for _, tag := range source.Tags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	updateData["tags"] = tags
+	groupIDs := slices.Clone(target.GroupIDs)
+	for _, groupID := range source.GroupIDs {
+		if !slices.Contains(groupIDs, groupID) {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	updateData["groupIds"] = groupIDs
+	attributes := bson.M{}
+	for key, value := range source.Attributes {
+		attributes[key] = value
+	}
+	for key, value := range target.Attributes {
+		attributes[key] = value
+	}
+	updateData["attributes"] = attributes
+
+	// Moving an admin record revokes its roles from the source and grants
+	// them to the target, as changing the roles of both would.
+	sourceAdminDoc, sourceAdmin, err := findAdminDocument(r, source.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	targetAdminDoc, targetAdmin, err := findAdminDocument(r, target.ID)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if sourceAdminDoc != nil {
+		if !services.CanAssignRoles(r.Context(), sourceAdmin.Roles) {
+			w.WriteHeader(403)
+			return
+		}
+		if services.GainsPermissions(r.Context(), targetAdmin.Roles, sourceAdmin.Roles) && requireApproval(w, r, "MergeUser", models.Approval{
+			Action:     models.ApprovalRoleEscalation,
+			Permission: enum.PermissionUserMerge,
+			Roles:      sourceAdmin.Roles,
+			TargetID:   target.ID,
+		}, form) {
+			return
+		}
+	}
+
+	// The source goes first so that its email is free when the target takes it.
+	sourceUpdate := bson.M{"deleteTime": now, "mergedInto": target.ID}
+	if fromSource("email") {
+		email := "merged-" + source.ID.Hex() + "@invalid"
+		sourceUpdate["email"] = email
+		sourceUpdate["search"] = services.UserSearchFields(email, source.FullName, source.Address)
+	}
+	merge := newMerge(source, target, sourceDoc, targetDoc, form.Fields, now)
+	if actor, ok := r.Context().Value(enum.ContextKeyUser).(schemas.User); ok {
+		merge.ActorID = actor.ID
+	}
+	db := mongodb.GetCollection(schemas.User{})
+	_, err = services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		merge.Admins = []bson.M{}
+		merge.TokenIDs = []string{}
+		result, err := helpers.UpdateVersion(ctx, db, source.ID, source.Version, bson.M{"$set": sourceUpdate})
+		if err == nil && result.MatchedCount == 0 {
+			err = errMergePrecondition
+		}
+		if err != nil {
+			return nil, err
+		}
+		result, err = helpers.UpdateVersion(ctx, db, target.ID, target.Version, bson.M{"$set": updateData})
+		if err == nil && result.MatchedCount == 0 {
+			err = errMergePrecondition
+		}
+		if err != nil {
+			return nil, err
+		}
+		moved, err := moveMergedRecords(ctx, &merge, sourceAdminDoc, sourceAdmin, targetAdminDoc, targetAdmin)
+		if err != nil {
+			return nil, err
+		}
+		_, err = models.Collection(models.MergeCollection).InsertOne(ctx, merge)
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: moved}, nil
+	})
+	if errors.Is(err, errMergePrecondition) {
+		w.WriteHeader(412)
+		return
+	}
+	if errors.Is(err, errMergeConflict) {
+		w.WriteHeader(409)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordUserHistory(r, source, services.HistoryActionMerge, sourceUpdate)
+	recordUserHistory(r, target, services.HistoryActionMerge, updateData)
+	renderUser(w, r, target.ID)
+}
+
+// moveMergedRecords moves the sessions and admin record of the source to the
+// target, snapshotting what it changes into merge, and returns how many admin
+// records it changed. When both users are admins the target keeps its record
+// with the roles of both. Admin records changed since they were loaded fail
+// the merge with errMergeConflict.
+func moveMergedRecords(ctx context.Context, merge *models.Merge, sourceDoc bson.M, source models.Admin, targetDoc bson.M, target models.Admin) (int64, error) {
+	tokens := mongodb.GetCollection(schemas.UserToken{})
+	cursor, err := tokens.Find(ctx, bson.M{"userId": merge.SourceID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	userTokens := []schemas.UserToken{}
+	err = cursor.All(ctx, &userTokens)
+	if err != nil {
+		return 0, err
+	}
+	for _, token := range userTokens {
+		merge.TokenIDs = append(merge.TokenIDs, token.ID)
+	}
+	if len(merge.TokenIDs) > 0 {
+		_, err = tokens.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": merge.TokenIDs}}, bson.M{"$set": bson.M{"userId": merge.TargetID}})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if sourceDoc == nil {
+		return 0, nil
+	}
+	admins := models.Collection(models.AdminCollection)
+	merge.Admins = append(merge.Admins, sourceDoc)
+	if targetDoc == nil {
+		result, err := helpers.UpdateVersion(ctx, admins, source.ID, source.Version, bson.M{
+			"$set": bson.M{"userId": merge.TargetID},
+		})
+		if err == nil && result.MatchedCount == 0 {
+			err = errMergeConflict
+		}
+		return 1, err
+	}
+	merge.Admins = append(merge.Admins, targetDoc)
+	roles := slices.Clone(target.Roles)
+	for _, role := range source.Roles {
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	result, err := helpers.UpdateVersion(ctx, admins, target.ID, target.Version, bson.M{
+		"$set": bson.M{"roles": roles},
+	})
+	if err == nil && result.MatchedCount == 0 {
+		err = errMergeConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	result, err = helpers.UpdateVersion(ctx, admins, source.ID, source.Version, bson.M{
+		"$set": bson.M{"deleteTime": merge.CreateTime},
+	})
+	if err == nil && result.MatchedCount == 0 {
+		err = errMergeConflict
+	}
+	return 2, err
+}
+
+func ListMerge(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	filter := bson.M{}
+	if user := r.URL.Query().Get("user"); user != "" {
+		userID, err := primitive.ObjectIDFromHex(user)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		filter["$or"] = bson.A{bson.M{"sourceId": userID}, bson.M{"targetId": userID}}
+	}
+	db := models.Collection(models.MergeCollection)
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	merges := []models.Merge{}
+	err = cursor.All(r.Context(), &merges)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"items":     responses.NewMerges(merges),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// RevertMerge restores both users, their sessions and admin records as they
+// were before a merge. It fails with 409 once either user or admin record
+// changed since. Giving the source its admin record back grants its roles,
+// which takes the same checks and approval as MergeUser.
+func RevertMerge(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	merge := models.Merge{}
+	db := models.Collection(models.MergeCollection)
+	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&merge)
+	if merge.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if merge.RevertTime > 0 || merge.Source == nil || merge.Target == nil {
+		w.WriteHeader(409)
+		return
+	}
+	sourceDoc, source, err := findUserDocument(r, merge.SourceID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	targetDoc, target, err := findUserDocument(r, merge.TargetID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		w.WriteHeader(404)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if source.Version != merge.SourceVersion || target.Version != merge.TargetVersion {
+		w.WriteHeader(409)
+		w.Write([]byte(errMergeConflict.Error()))
+		return
+	}
+	admins := make([]models.Admin, 0, len(merge.Admins))
+	roles := []string{}
+	for _, snapshot := range merge.Admins {
+		admin := models.Admin{}
+		data, err := bson.Marshal(snapshot)
+		if err == nil {
+			err = bson.Unmarshal(data, &admin)
+		}
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		admins = append(admins, admin)
+		roles = append(roles, admin.Roles...)
+	}
+	if len(admins) > 0 {
+		if !services.CanAssignRoles(r.Context(), roles) {
+			w.WriteHeader(403)
+			return
+		}
+		// The first snapshot is the admin record of the source.
+		if services.GainsPermissions(r.Context(), nil, admins[0].Roles) && requireApproval(w, r, "RevertMerge", models.Approval{
+			Action:     models.ApprovalRoleEscalation,
+			Permission: enum.PermissionUserMerge,
+			Roles:      admins[0].Roles,
+			TargetID:   merge.SourceID,
+		}, nil) {
+			return
+		}
+	}
+	targetPassword := targetDoc["password"]
+	if merge.ReplacedPassword != "" {
+		targetPassword = merge.ReplacedPassword
+	}
+
+	update := bson.M{"revertTime": time.Now().Unix()}
+	if actor, ok := r.Context().Value(enum.ContextKeyUser).(schemas.User); ok {
+		update["revertedBy"] = actor.ID
+	}
+	_, err = services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		// The target goes first so that an email it took from the source is free.
+		err := restoreUser(ctx, merge.Target, merge.TargetVersion, targetPassword)
+		if err != nil {
+			return nil, err
+		}
+		err = restoreUser(ctx, merge.Source, merge.SourceVersion, sourceDoc["password"])
+		if err != nil {
+			return nil, err
+		}
+		if len(merge.TokenIDs) > 0 {
+			_, err = mongodb.GetCollection(schemas.UserToken{}).UpdateMany(ctx, bson.M{
+				"_id":    bson.M{"$in": merge.TokenIDs},
+				"userId": merge.TargetID,
+			}, bson.M{"$set": bson.M{"userId": merge.SourceID}})
+			if err != nil {
+				return nil, err
+			}
+		}
+		for i, snapshot := range merge.Admins {
+			err = restoreAdmin(ctx, snapshot, admins[i].Version)
+			if err != nil {
+				return nil, err
+			}
+		}
+		_, err = db.UpdateOne(ctx, bson.M{"_id": merge.ID}, bson.M{"$set": update})
+		if err != nil {
+			return nil, err
+		}
+		return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: int64(len(merge.Admins))}, nil
+	})
+	if errors.Is(err, errMergeConflict) {
+		w.WriteHeader(409)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	for _, pair := range []struct {
+		user     models.User
+		snapshot bson.M
+	}{{source, merge.Source}, {target, merge.Target}} {
+		restored := models.User{}
+		data, _ := bson.Marshal(pair.snapshot)
+		bson.Unmarshal(data, &restored)
+		recordUserHistory(r, pair.user, services.HistoryActionUnmerge, userHistoryFields(restored))
+	}
+	renderUser(w, r, merge.TargetID)
+}
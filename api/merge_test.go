@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewMergeLeavesPasswordsOutOfSnapshots(t *testing.T) {
+	source := models.User{User: schemas.User{ID: primitive.NewObjectID(), Password: "source-hash"}, Version: 2}
+	target := models.User{User: schemas.User{ID: primitive.NewObjectID(), Password: "target-hash"}, Version: 5}
+	tests := []struct {
+		name     string
+		fields   map[string]string
+		replaced string
+	}{
+		{"target password kept", map[string]string{"email": "source"}, ""},
+		{"source password taken", map[string]string{"password": "source"}, "target-hash"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sourceDoc := bson.M{"_id": source.ID, "password": source.Password}
+			targetDoc := bson.M{"_id": target.ID, "password": target.Password}
+			merge := newMerge(source, target, sourceDoc, targetDoc, tt.fields, 100)
+			if _, ok := merge.Source["password"]; ok {
+				t.Error("source snapshot has the password hash")
+			}
+			if _, ok := merge.Target["password"]; ok {
+				t.Error("target snapshot has the password hash")
+			}
+			if merge.ReplacedPassword != tt.replaced {
+				t.Errorf("ReplacedPassword = %q, want %q", merge.ReplacedPassword, tt.replaced)
+			}
+			if merge.SourceVersion != 3 || merge.TargetVersion != 6 {
+				t.Errorf("versions = %d, %d, want 3, 6", merge.SourceVersion, merge.TargetVersion)
+			}
+		})
+	}
+}
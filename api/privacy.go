@@ -0,0 +1,90 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/go-chi/chi/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ExportUser responds with a ZIP archive of everything held on the user, one
+// JSON document per registered privacy handler.
+func ExportUser(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	user := models.User{}
+	mongodb.GetCollection(user.User).FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&user)
+	if user.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	buf := bytes.Buffer{}
+	err = services.ExportUserData(r.Context(), id, &buf)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="user-`+id.Hex()+`.zip"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
+
+// EraseUser anonymizes the personal data of a user across every registered
+// privacy handler, the user document itself is kept for references.
+func EraseUser(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	user := models.User{}
+	mongodb.GetCollection(user.User).FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&user)
+	if user.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if lockoutConflict(w, r, services.CheckSelf(r.Context(), id)) {
+		return
+	}
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
+	// Revoke admin rights first, where the last superadmin can be refused.
+	_, err = services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		return models.Collection(models.AdminCollection).UpdateMany(ctx, bson.M{"userId": id, "deleteTime": nil}, bson.M{
+			"$set": bson.M{"deleteTime": time.Now().Unix()},
+			"$inc": bson.M{"version": 1},
+		})
+	})
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = services.EraseUserData(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	renderUser(w, r, id)
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/anyshare/anyshare-admin-api/enum"
 	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/services"
 	"github.com/anyshare/anyshare-common/mongodb"
 	"github.com/anyshare/anyshare-common/schemas"
 	"github.com/go-chi/render"
@@ -14,7 +16,7 @@ import (
 )
 
 func GetProfile(w http.ResponseWriter, r *http.Request) {
-	render.JSON(w, r, r.Context().Value(enum.ContextKeyUser))
+	renderUser(w, r, r.Context().Value(enum.ContextKeyUser).(schemas.User).ID)
 }
 
 func UpdateProfile(w http.ResponseWriter, r *http.Request) {
@@ -36,8 +38,8 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, formErrors)
 		return
 	}
-	user := schemas.User{}
-	db := mongodb.GetCollection(user)
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
 	userId := r.Context().Value(enum.ContextKeyUser).(schemas.User).ID
 	db.FindOne(r.Context(), bson.M{"_id": userId}).Decode(&user)
 	if user.ID.IsZero() {
@@ -45,17 +47,31 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, render.M{"email": helpers.Translate(r.Context(), "accountNotExist")})
 		return
 	}
-	result, err := db.UpdateByID(r.Context(), userId, bson.M{"$set": bson.M{
-		"full_name": form.FullName,
-		"address":   form.Address,
-		"desc":      form.Desc,
-	}})
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
+	updateData := bson.M{
+		"fullName": form.FullName,
+		"address":  form.Address,
+		"desc":     form.Desc,
+		"search":   services.UserSearchFields(user.Email, form.FullName, form.Address),
+	}
+	result, err := helpers.UpdateVersion(r.Context(), db, userId, user.Version, bson.M{"$set": updateData})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordUserHistory(r, user, services.HistoryActionUpdate, updateData)
+	renderUser(w, r, userId)
+}
+
+func PatchProfile(w http.ResponseWriter, r *http.Request) {
+	patchUser(w, r, r.Context().Value(enum.ContextKeyUser).(schemas.User).ID, profilePatchFields)
 }
 
 func ChangePassword(w http.ResponseWriter, r *http.Request) {
@@ -76,8 +92,8 @@ func ChangePassword(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, formErrors)
 		return
 	}
-	user := schemas.User{}
-	db := mongodb.GetCollection(user)
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
 	userId := r.Context().Value(enum.ContextKeyUser).(schemas.User).ID
 	db.FindOne(r.Context(), bson.M{"_id": userId}).Decode(&user)
 	if user.ID.IsZero() {
@@ -85,6 +101,9 @@ func ChangePassword(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, render.M{"oldPassword": helpers.Translate(r.Context(), "wrongPassword")})
 		return
 	}
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
 	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(form.OldPassword)) != nil {
 		w.WriteHeader(422)
 		render.JSON(w, r, render.M{"oldPassword": helpers.Translate(r.Context(), "wrongPassword")})
@@ -96,11 +115,17 @@ func ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(form.NewPassword), 10)
-	result, err := db.UpdateByID(r.Context(), userId, bson.M{"$set": bson.M{"password": string(hash)}})
+	updateData := bson.M{"password": string(hash)}
+	result, err := helpers.UpdateVersion(r.Context(), db, userId, user.Version, bson.M{"$set": updateData})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordUserHistory(r, user, services.HistoryActionPassword, updateData)
+	renderUser(w, r, userId)
 }
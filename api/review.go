@@ -0,0 +1,391 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func ListReview(w http.ResponseWriter, r *http.Request) {
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	filter := bson.M{}
+	if status := r.URL.Query().Get("status"); status != "" {
+		filter["status"] = status
+	}
+	db := models.Collection(models.ReviewCollection)
+	count, err := db.CountDocuments(r.Context(), filter)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	pageCount := math.Ceil(float64(count) / float64(pageSize))
+
+	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}}
+	cursor, err := db.Find(r.Context(), filter, &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	reviews := []models.Review{}
+	err = cursor.All(r.Context(), &reviews)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"items":     responses.NewReviews(r.Context(), reviews),
+		"page":      page,
+		"itemCount": count,
+		"pageCount": pageCount,
+	})
+}
+
+// findReview loads the campaign in the "id" URL parameter, writing the error
+// response and returning false when there is none.
+func findReview(w http.ResponseWriter, r *http.Request) (models.Review, bool) {
+	review := models.Review{}
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return review, false
+	}
+	models.Collection(models.ReviewCollection).FindOne(r.Context(), bson.M{"_id": id}).Decode(&review)
+	if review.ID.IsZero() {
+		w.WriteHeader(404)
+		return review, false
+	}
+	return review, true
+}
+
+// findReviewItem returns the index of the item of review for the admin in
+// the "adminId" URL parameter, writing the error response and returning -1
+// when there is none or the campaign is closed.
+func findReviewItem(w http.ResponseWriter, r *http.Request, review models.Review) int {
+	adminID, err := primitive.ObjectIDFromHex(chi.URLParam(r, "adminId"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return -1
+	}
+	for i, item := range review.Items {
+		if item.AdminID != adminID {
+			continue
+		}
+		if review.Status != models.ReviewOpen {
+			w.WriteHeader(409)
+			return -1
+		}
+		return i
+	}
+	w.WriteHeader(404)
+	return -1
+}
+
+// activeAdminUser reports whether userID belongs to an active admin.
+func activeAdminUser(r *http.Request, userID primitive.ObjectID) (bool, error) {
+	count, err := models.Collection(models.AdminCollection).CountDocuments(r.Context(), bson.M{"userId": userID, "deleteTime": nil})
+	return count > 0, err
+}
+
+func GetReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := findReview(w, r)
+	if !ok {
+		return
+	}
+	render.JSON(w, r, responses.NewReview(r.Context(), review, true))
+}
+
+// CreateReview starts a campaign over every active admin. Reviewers are user
+// ids of admins, the admins allowed to run reviews when none are given.
+func CreateReview(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Name        string   `json:"name" validate:"required,max=100"`
+		DueTime     int64    `json:"dueTime" validate:"required"`
+		ReviewerIDs []string `json:"reviewerIds" validate:"unique"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	if form.DueTime <= time.Now().Unix() {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"dueTime": helpers.Translate(r.Context(), "reviewDueTime")})
+		return
+	}
+	reviewers := []primitive.ObjectID{}
+	for _, value := range form.ReviewerIDs {
+		reviewer, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		ok, err := activeAdminUser(r, reviewer)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		if !ok {
+			w.WriteHeader(422)
+			render.JSON(w, r, render.M{"reviewerIds": helpers.Translate(r.Context(), "reviewerNotAdmin")})
+			return
+		}
+		reviewers = append(reviewers, reviewer)
+	}
+	if len(reviewers) == 0 {
+		reviewers, err = services.Reviewers(r.Context())
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	review := models.Review{Name: form.Name, DueTime: form.DueTime}
+	if actor, ok := r.Context().Value(enum.ContextKeyUser).(schemas.User); ok {
+		review.CreatedBy = actor.ID
+	}
+	review, err = services.StartReview(r.Context(), review, reviewers)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewReview(r.Context(), review, true))
+}
+
+// AssignReviewer hands the decision on one admin to another reviewer.
+func AssignReviewer(w http.ResponseWriter, r *http.Request) {
+	review, ok := findReview(w, r)
+	if !ok {
+		return
+	}
+	index := findReviewItem(w, r, review)
+	if index < 0 {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		ReviewerID string `json:"reviewerId" validate:"required"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	reviewer, err := primitive.ObjectIDFromHex(form.ReviewerID)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	ok, err = activeAdminUser(r, reviewer)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !ok {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"reviewerId": helpers.Translate(r.Context(), "reviewerNotAdmin")})
+		return
+	}
+	if reviewer == review.Items[index].UserID {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"reviewerId": helpers.Translate(r.Context(), "reviewSelf")})
+		return
+	}
+	updateReviewItem(w, r, review, index, bson.M{"reviewerId": reviewer})
+}
+
+// DecideReview records whether an admin keeps their access. Only the
+// assigned reviewer decides, or anyone running reviews when there is none,
+// and never on their own access.
+func DecideReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := findReview(w, r)
+	if !ok {
+		return
+	}
+	index := findReviewItem(w, r, review)
+	if index < 0 {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Decision string `json:"decision" validate:"required,oneof=keep revoke"`
+		Comment  string `json:"comment" validate:"max=1000"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	item := review.Items[index]
+	actor, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	if actor.ID == item.UserID {
+		w.WriteHeader(403)
+		return
+	}
+	if item.ReviewerID != actor.ID && (!item.ReviewerID.IsZero() || !helpers.HasPermission(r.Context(), enum.PermissionReviewWrite)) {
+		w.WriteHeader(403)
+		return
+	}
+	updateReviewItem(w, r, review, index, bson.M{
+		"decision":   form.Decision,
+		"comment":    form.Comment,
+		"decidedBy":  actor.ID,
+		"decideTime": time.Now().Unix(),
+	})
+}
+
+// updateReviewItem sets fields of the item at index while the campaign is
+// still open and responds with the campaign.
+func updateReviewItem(w http.ResponseWriter, r *http.Request, review models.Review, index int, fields bson.M) {
+	set := bson.M{}
+	for field, value := range fields {
+		set["items.$."+field] = value
+	}
+	db := models.Collection(models.ReviewCollection)
+	result, err := db.UpdateOne(r.Context(), bson.M{
+		"_id":           review.ID,
+		"status":        models.ReviewOpen,
+		"items.adminId": review.Items[index].AdminID,
+	}, bson.M{"$set": set})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if result.MatchedCount == 0 {
+		w.WriteHeader(409)
+		return
+	}
+	before := services.ReviewHistoryFields(review)
+	db.FindOne(r.Context(), bson.M{"_id": review.ID}).Decode(&review)
+	err = services.RecordHistory(r.Context(), models.ReviewCollection, review.ID, services.HistoryActionUpdate, before, services.ReviewHistoryFields(review))
+	if err != nil {
+		log.Println("record review history:", err)
+	}
+	render.JSON(w, r, responses.NewReview(r.Context(), review, true))
+}
+
+// CloseReview ends a campaign ahead of its due time and applies its revoke
+// decisions.
+func CloseReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := findReview(w, r)
+	if !ok {
+		return
+	}
+	actor, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	review, err := services.CloseReview(r.Context(), review.ID, actor.ID)
+	if errors.Is(err, services.ErrReviewClosed) {
+		w.WriteHeader(409)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewReview(r.Context(), review, true))
+}
+
+// csvCell keeps spreadsheets from reading free text as a formula.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportReview answers the decisions of a campaign as CSV evidence.
+func ExportReview(w http.ResponseWriter, r *http.Request) {
+	review, ok := findReview(w, r)
+	if !ok {
+		return
+	}
+	formatTime := func(unix int64) string {
+		if unix == 0 {
+			return ""
+		}
+		return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+	}
+	formatID := func(id primitive.ObjectID) string {
+		if id.IsZero() {
+			return ""
+		}
+		return id.Hex()
+	}
+	buf := bytes.Buffer{}
+	writer := csv.NewWriter(&buf)
+	writer.Write([]string{
+		"campaign", "status", "adminId", "userId", "email", "fullName", "roles", "reviewerId",
+		"decision", "comment", "decidedBy", "decideTime", "applyTime", "applyError",
+	})
+	// Items come out in the same order, with emails masked as the admin sees them.
+	shown := responses.NewReview(r.Context(), review, true).Items
+	for i, item := range review.Items {
+		writer.Write([]string{
+			csvCell(review.Name), review.Status, item.AdminID.Hex(), item.UserID.Hex(), csvCell(shown[i].Email),
+			csvCell(item.FullName), strings.Join(item.Roles, ";"), formatID(item.ReviewerID), item.Decision,
+			csvCell(item.Comment), formatID(item.DecidedBy), formatTime(item.DecideTime), formatTime(item.ApplyTime),
+			item.ApplyError,
+		})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="access-review-`+review.ID.Hex()+`.csv"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Write(buf.Bytes())
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func ListPermission(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, r, render.M{"items": services.Permissions()})
+}
+
+func ListRole(w http.ResponseWriter, r *http.Request) {
+	roles, err := services.Roles(r.Context())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	keys := []string{}
+	for key := range roles {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	items := make([]responses.Role, 0, len(keys))
+	for _, key := range keys {
+		effective, err := services.EffectivePermissions(r.Context(), []string{key})
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		items = append(items, responses.NewRole(roles[key], effective))
+	}
+	render.JSON(w, r, render.M{"items": items})
+}
+
+// findRole loads the role in the "key" URL parameter, writing the error
+// response and returning false when there is none.
+func findRole(w http.ResponseWriter, r *http.Request) (models.Role, map[string]models.Role, bool) {
+	roles, err := services.Roles(r.Context())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return models.Role{}, nil, false
+	}
+	role, ok := roles[chi.URLParam(r, "key")]
+	if !ok {
+		w.WriteHeader(404)
+		return role, roles, false
+	}
+	return role, roles, true
+}
+
+func renderRole(w http.ResponseWriter, r *http.Request, role models.Role) {
+	effective, err := services.EffectivePermissions(r.Context(), []string{role.Key})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, responses.NewRole(role, effective))
+}
+
+func GetRole(w http.ResponseWriter, r *http.Request) {
+	role, _, ok := findRole(w, r)
+	if !ok {
+		return
+	}
+	renderRole(w, r, role)
+}
+
+// validateRole checks the permissions and parents of a role on top of the
+// form itself, parents must exist and not inherit the role back.
+func validateRole(r *http.Request, form interface{}, role models.Role, roles map[string]models.Role) map[string]string {
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors == nil {
+		formErrors = map[string]string{}
+	}
+	for _, permission := range role.Permissions {
+		if !services.PermissionExists(permission) {
+			formErrors["permissions"] = helpers.Translate(r.Context(), "unknownPermission")
+		}
+	}
+	if services.InheritsRole(roles, role.Inherits, role.Key) {
+		formErrors["inherits"] = helpers.Translate(r.Context(), "roleCycle")
+	}
+	if len(formErrors) == 0 {
+		return nil
+	}
+	return formErrors
+}
+
+func roleHistoryFields(role models.Role) bson.M {
+	permissions := role.Permissions
+	if permissions == nil {
+		permissions = []string{}
+	}
+	inherits := role.Inherits
+	if inherits == nil {
+		inherits = []string{}
+	}
+	return bson.M{
+		"key":         role.Key,
+		"name":        role.Name,
+		"desc":        role.Desc,
+		"permissions": permissions,
+		"inherits":    inherits,
+	}
+}
+
+func recordRoleHistory(r *http.Request, role models.Role, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.RoleCollection, role.ID, action, roleHistoryFields(role), update)
+	if err != nil {
+		log.Println("record role history:", err)
+	}
+}
+
+// authorizeRole checks that the current admin holds every permission role
+// would gain, so that nobody can hand out more than they have, and puts the
+// change on hold as a role escalation when it gains any. It writes the
+// response and returns false when the change cannot go on now.
+func authorizeRole(w http.ResponseWriter, r *http.Request, handler string, role models.Role, roles map[string]models.Role, form interface{}) bool {
+	gained := services.GainedPermissions(roles, role)
+	if !services.HoldsPermissions(r.Context(), gained) {
+		w.WriteHeader(403)
+		return false
+	}
+	return len(gained) == 0 || !requireApproval(w, r, handler, models.Approval{
+		Action:      models.ApprovalRoleEscalation,
+		Permission:  enum.PermissionRoleWrite,
+		Permissions: gained,
+	}, form)
+}
+
+func CreateRole(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Key         string   `json:"key" validate:"required,max=50,alphanum"`
+		Name        string   `json:"name" validate:"required,max=50"`
+		Desc        string   `json:"desc" validate:"max=1000"`
+		Permissions []string `json:"permissions" validate:"unique"`
+		Inherits    []string `json:"inherits" validate:"unique,dive,role"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	roles, err := services.Roles(r.Context())
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	now := time.Now().Unix()
+	role := models.Role{
+		ID:          primitive.NewObjectID(),
+		Key:         form.Key,
+		Name:        form.Name,
+		Desc:        form.Desc,
+		Permissions: form.Permissions,
+		Inherits:    form.Inherits,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	formErrors := validateRole(r, form, role, roles)
+	if _, taken := roles[role.Key]; taken && formErrors == nil {
+		formErrors = map[string]string{"key": helpers.Translate(r.Context(), "roleKeyTaken")}
+	}
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	if !authorizeRole(w, r, "CreateRole", role, roles, form) {
+		return
+	}
+	_, err = models.Collection(models.RoleCollection).InsertOne(r.Context(), role)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordRoleHistory(r, models.Role{ID: role.ID}, services.HistoryActionCreate, roleHistoryFields(role))
+	renderRole(w, r, role)
+}
+
+// UpdateRole changes a custom role, built-in roles are immutable.
+func UpdateRole(w http.ResponseWriter, r *http.Request) {
+	role, roles, ok := findRole(w, r)
+	if !ok {
+		return
+	}
+	if role.BuiltIn {
+		w.WriteHeader(403)
+		return
+	}
+	before := role
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Name        string   `json:"name" validate:"required,max=50"`
+		Desc        string   `json:"desc" validate:"max=1000"`
+		Permissions []string `json:"permissions" validate:"unique"`
+		Inherits    []string `json:"inherits" validate:"unique,dive,role"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	role.Name = form.Name
+	role.Desc = form.Desc
+	role.Permissions = form.Permissions
+	role.Inherits = form.Inherits
+	role.UpdateTime = time.Now().Unix()
+	formErrors := validateRole(r, form, role, roles)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	if !authorizeRole(w, r, "UpdateRole", role, roles, form) {
+		return
+	}
+	_, err = services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		return models.Collection(models.RoleCollection).ReplaceOne(ctx, bson.M{"_id": role.ID}, role)
+	})
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordRoleHistory(r, before, services.HistoryActionUpdate, roleHistoryFields(role))
+	renderRole(w, r, role)
+}
+
+// DeleteRole removes a custom role that no active admin holds, no scheduled or
+// active grant gives and no other role inherits.
+func DeleteRole(w http.ResponseWriter, r *http.Request) {
+	role, _, ok := findRole(w, r)
+	if !ok {
+		return
+	}
+	if role.BuiltIn {
+		w.WriteHeader(403)
+		return
+	}
+	admins, err := models.Collection(models.AdminCollection).CountDocuments(r.Context(), bson.M{"roles": role.Key, "deleteTime": nil})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	grants, err := models.Collection(models.GrantCollection).CountDocuments(r.Context(), bson.M{
+		"role":       role.Key,
+		"revokeTime": nil,
+		"endTime":    bson.M{"$gt": time.Now().Unix()},
+	})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	children, err := models.Collection(models.RoleCollection).CountDocuments(r.Context(), bson.M{"inherits": role.Key})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if admins > 0 || grants > 0 || children > 0 {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"key": helpers.Translate(r.Context(), "roleInUse")})
+		return
+	}
+	_, err = models.Collection(models.RoleCollection).DeleteOne(r.Context(), bson.M{"_id": role.ID})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordRoleHistory(r, role, services.HistoryActionDelete, roleHistoryFields(models.Role{}))
+	w.WriteHeader(204)
+}
+
+// GetAdminPermissions shows the permissions an admin holds through each of
+// their roles, active grants included, and in total.
+func GetAdminPermissions(w http.ResponseWriter, r *http.Request) {
+	admin, ok := findActiveAdmin(w, r)
+	if !ok {
+		return
+	}
+	roles, err := services.AdminRoles(r.Context(), admin)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	byRole := map[string][]string{}
+	for _, key := range roles {
+		permissions, err := services.EffectivePermissions(r.Context(), []string{key})
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		byRole[key] = permissions
+	}
+	permissions, err := services.EffectivePermissions(r.Context(), roles)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{
+		"roles":       byRole,
+		"granted":     roles[len(admin.Roles):],
+		"permissions": permissions,
+	})
+}
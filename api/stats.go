@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/go-chi/render"
+)
+
+// Maximum number of days GetStats covers at once.
+const maxStatsDays = 366
+
+var statsCache = helpers.Cache[services.Stats]{TTL: statsCacheTTL()}
+
+// statsCacheTTL reads STATS_CACHE_TTL as a duration such as "5m", "0"
+// disables caching.
+func statsCacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("STATS_CACHE_TTL"))
+	if err != nil {
+		return 5 * time.Minute
+	}
+	return ttl
+}
+
+// GetStats returns dashboard statistics over the days from "from" to "to"
+// (YYYY-MM-DD, inclusive, defaulting to the last 30 days) bucketed by
+// "interval" in the "tz" time zone.
+func GetStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tz := query.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	location, err := time.LoadLocation(tz)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	interval := query.Get("interval")
+	switch interval {
+	case "":
+		interval = services.StatsIntervalDay
+	case services.StatsIntervalDay, services.StatsIntervalWeek, services.StatsIntervalMonth:
+	default:
+		w.WriteHeader(400)
+		w.Write([]byte("interval must be day, week or month"))
+		return
+	}
+
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	rg := services.StatsRange{
+		From:     today.AddDate(0, 0, -29),
+		To:       today.AddDate(0, 0, 1),
+		Interval: interval,
+		Location: location,
+	}
+	if from := query.Get("from"); from != "" {
+		rg.From, err = time.ParseInLocation(time.DateOnly, from, location)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+	}
+	if to := query.Get("to"); to != "" {
+		rg.To, err = time.ParseInLocation(time.DateOnly, to, location)
+		if err != nil {
+			w.WriteHeader(400)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		rg.To = rg.To.AddDate(0, 0, 1)
+	}
+	if !rg.From.Before(rg.To) || rg.From.AddDate(0, 0, maxStatsDays).Before(rg.To) {
+		w.WriteHeader(400)
+		w.Write([]byte("invalid range"))
+		return
+	}
+
+	// Scoped admins see statistics over their users only.
+	key := rg.From.Format(time.DateOnly) + "|" + rg.To.Format(time.DateOnly) + "|" + interval + "|" + location.String()
+	if scope := services.ScopeFilter(r.Context()); scope != nil {
+		key += "|" + fmt.Sprint(scope)
+	}
+	stats, ok := statsCache.Get(key)
+	if !ok {
+		stats, err = services.UserStats(r.Context(), rg)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		statsCache.Set(key, stats)
+	}
+	render.JSON(w, r, render.M{
+		"from":     rg.From.Format(time.DateOnly),
+		"to":       rg.To.AddDate(0, 0, -1).Format(time.DateOnly),
+		"interval": interval,
+		"tz":       location.String(),
+		"stats":    stats,
+	})
+}
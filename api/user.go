@@ -1,61 +1,263 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
 	"github.com/anyshare/anyshare-common/mongodb"
 	"github.com/anyshare/anyshare-common/schemas"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func ListUser(w http.ResponseWriter, r *http.Request) {
-	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
-	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
-	skip := (page - 1) * pageSize
+// Query parameters of ListUser that take a time, see helpers.ParseTimeParam.
+var userTimeParams = map[string]struct {
+	field string
+	op    string
+}{
+	"joinedAfter":   {"joinTime", "$gte"},
+	"joinedBefore":  {"joinTime", "$lt"},
+	"deletedAfter":  {"deleteTime", "$gte"},
+	"deletedBefore": {"deleteTime", "$lt"},
+}
+
+// userListFilter builds the user filter shared by ListUser, bulk actions and
+// saved views from the status, group, tag, time and attr.<key> query
+// parameters, along with the keyword search. Relative times follow "tz".
+func userListFilter(ctx context.Context, query url.Values) (bson.M, *services.UserSearch, error) {
+	location := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		var err error
+		if location, err = time.LoadLocation(tz); err != nil {
+			return nil, nil, err
+		}
+	}
+	now := time.Now().In(location)
 
 	filter := bson.M{}
-	keyword := strings.TrimSpace(r.URL.Query().Get("keyword"))
-	if keyword != "" {
-		filter["email"] = bson.M{"$regex": keyword}
-	}
-	status := strings.TrimSpace(r.URL.Query().Get("status"))
-	switch status {
-	case "deleted":
-		filter["deleteTime"] = bson.M{"$gt": 0}
+	status := strings.TrimSpace(query.Get("status"))
+	deleteTime := bson.M{}
+	for param, bound := range userTimeParams {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		unix, err := helpers.ParseTimeParam(value, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		if bound.field == "deleteTime" {
+			deleteTime[bound.op] = unix
+			continue
+		}
+		cond, _ := filter[bound.field].(bson.M)
+		if cond == nil {
+			cond = bson.M{}
+			filter[bound.field] = cond
+		}
+		cond[bound.op] = unix
+	}
+	switch {
+	case status == "deleted" || len(deleteTime) > 0:
+		deleteTime["$gt"] = 0
+		filter["deleteTime"] = deleteTime
 	default:
 		filter["deleteTime"] = nil
 	}
+	if value := query.Get("lastLoginBefore"); value != "" {
+		unix, err := helpers.ParseTimeParam(value, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Users who never logged in count as inactive too.
+		filter["$or"] = bson.A{
+			bson.M{"lastLoginTime": bson.M{"$lt": unix}},
+			bson.M{"lastLoginTime": nil},
+		}
+	}
+	if group := query.Get("group"); group != "" {
+		groupID, err := primitive.ObjectIDFromHex(group)
+		if err != nil {
+			return nil, nil, err
+		}
+		filter["groupIds"] = groupID
+	}
+	if tags := helpers.NormalizeTags(query["tag"]); len(tags) > 0 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+	attributeFilter, err := services.AttributeFilter(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, value := range attributeFilter {
+		filter[key] = value
+	}
+	return filter, services.NewUserSearch(query.Get("keyword")), nil
+}
+
+// Fields ListUser can sort by with "sort", prefixed with "-" for descending.
+var userSortFields = []string{"joinTime", "fullName", "email", "lastLoginTime"}
 
-	users := []schemas.User{}
-	db := mongodb.GetCollection(users)
+func userListSort(query url.Values) (bson.D, error) {
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = "-joinTime"
+	}
+	field, desc := strings.CutPrefix(sort, "-")
+	if !slices.Contains(userSortFields, field) {
+		return nil, fmt.Errorf("cannot sort by %q", field)
+	}
+	order := 1
+	if desc {
+		order = -1
+	}
+	return bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}}, nil
+}
 
-	count, err := db.CountDocuments(r.Context(), filter)
+// ListUser lists users by page, or by cursor when after, before or limit is
+// given. Either way itemCount, and pageCount for pages, come with count=true.
+func ListUser(w http.ResponseWriter, r *http.Request) {
+	result := render.M{}
+	if viewID := r.URL.Query().Get("view"); viewID != "" {
+		view, ok := findView(w, r, viewID)
+		if !ok {
+			return
+		}
+		r = withViewQuery(r, view)
+		result["view"] = responses.NewView(view)
+	}
+	filter, search, err := userListFilter(r.Context(), r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	sort, err := userListSort(r.URL.Query())
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if helpers.IsKeysetRequest(r) {
+		// Cursors follow the (joinTime, _id) order, so results are neither
+		// sorted nor ranked.
+		if !search.IsEmpty() {
+			filter["$and"] = search.Conditions("")
+		}
+		listUserByCursor(w, r, services.ScopeUsers(r.Context(), filter), result)
+		return
+	}
+	filter = services.ScopeUsers(r.Context(), filter)
+
+	page := helpers.StringToInt64(r.URL.Query().Get("page"), 1)
+	pageSize := helpers.StringToInt64(r.URL.Query().Get("pageSize"), 50)
+	skip := (page - 1) * pageSize
+
+	users := []models.User{}
+	db := mongodb.GetCollection([]schemas.User{})
+
+	// Counting scans every match, so it is left out unless asked for, as with
+	// cursors. One more user than the page holds tells whether there is a
+	// next page.
+	if r.URL.Query().Get("count") == "true" {
+		countFilter := filter
+		if !search.IsEmpty() {
+			countFilter = bson.M{"$and": append(bson.A{filter}, search.Conditions("")...)}
+		}
+		count, err := db.CountDocuments(r.Context(), countFilter)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		result["itemCount"] = count
+		result["pageCount"] = math.Ceil(float64(count) / float64(pageSize))
+	}
+
+	limit := pageSize + 1
+	var cursor *mongo.Cursor
+	if search.IsEmpty() {
+		opts := options.FindOptions{Skip: &skip, Limit: &limit, Sort: sort}
+		cursor, err = db.Find(r.Context(), filter, &opts)
+	} else {
+		cursor, err = db.Aggregate(r.Context(), search.Pipeline(filter, skip, limit))
+	}
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	pageCount := math.Ceil(float64(count) / float64(pageSize))
+	for cursor.Next(r.Context()) {
+		user := models.User{}
+		err := cursor.Decode(&user)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		users = append(users, user)
+	}
+	hasNext := int64(len(users)) > pageSize
+	if hasNext {
+		users = users[:pageSize]
+	}
+
+	result["items"] = responses.NewUsers(r.Context(), users)
+	result["page"] = page
+	result["hasNext"] = hasNext
+	render.JSON(w, r, result)
+}
 
-	opts := options.FindOptions{Skip: &skip, Limit: &pageSize, Sort: bson.D{{Key: "joinTime", Value: -1}}}
-	cursor, err := db.Find(r.Context(), filter, &opts)
+func listUserByCursor(w http.ResponseWriter, r *http.Request, filter bson.M, result render.M) {
+	ks, err := helpers.ParseKeyset(r)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	users := []models.User{}
+	db := mongodb.GetCollection([]schemas.User{})
+
+	if r.URL.Query().Get("count") == "true" {
+		count, err := db.CountDocuments(r.Context(), filter)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		result["itemCount"] = count
+	}
+
+	limit := ks.Limit + 1
+	opts := options.FindOptions{Limit: &limit, Sort: ks.Sort()}
+	cursor, err := db.Find(r.Context(), bson.M{"$and": bson.A{filter, ks.Filter()}}, &opts)
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
 	for cursor.Next(r.Context()) {
-		user := schemas.User{}
+		user := models.User{}
 		err := cursor.Decode(&user)
 		if err != nil {
 			w.WriteHeader(500)
@@ -65,12 +267,14 @@ func ListUser(w http.ResponseWriter, r *http.Request) {
 		users = append(users, user)
 	}
 
-	render.JSON(w, r, render.M{
-		"items":     users,
-		"page":      page,
-		"itemCount": count,
-		"pageCount": pageCount,
+	users, next, prev := helpers.Page(ks, users, func(user models.User) helpers.Cursor {
+		return helpers.Cursor{JoinTime: user.JoinTime, ID: user.ID}
 	})
+	helpers.SetLinkHeader(w, r, next, prev)
+	result["items"] = responses.NewUsers(r.Context(), users)
+	result["next"] = next
+	result["prev"] = prev
+	render.JSON(w, r, result)
 }
 
 func GetUser(w http.ResponseWriter, r *http.Request) {
@@ -80,30 +284,42 @@ func GetUser(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(err.Error()))
 		return
 	}
-	user := schemas.User{}
-	mongodb.GetCollection(user).FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
+	user := models.User{}
+	mongodb.GetCollection(user.User).FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&user)
 	if user.ID.IsZero() {
 		w.WriteHeader(404)
 		return
 	}
-	render.JSON(w, r, user)
+	if helpers.NotModified(w, r, user.Version) {
+		return
+	}
+	render.JSON(w, r, responses.NewUser(r.Context(), user))
 }
 
 func CreateUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var form struct {
-		Email    string `json:"email" validate:"required,email"`
-		Password string `json:"password" validate:"required,min=7,max=50"`
-		FullName string `json:"fullName" validate:"required,max=50"`
-		Address  string `json:"address" validate:"required,max=250"`
-		Desc     string `json:"desc" validate:"max=1000"`
+		Email    string   `json:"email" validate:"required,email,unique_email"`
+		Password string   `json:"password" validate:"required,min=7,max=50"`
+		FullName string   `json:"fullName" validate:"required,max=50"`
+		Address  string   `json:"address" validate:"required,max=250"`
+		Desc     string   `json:"desc" validate:"max=1000"`
+		Tags     []string `json:"tags" validate:"max=20,dive,max=50"`
+
+		Attributes map[string]interface{} `json:"attributes"`
 	}
 	err := decoder.Decode(&form)
 	if err != nil {
 		w.WriteHeader(400)
 		return
 	}
-	formErrors := helpers.ValidateStruct(r.Context(), form)
+	form.Email = helpers.NormalizeEmail(form.Email)
+	attributes, formErrors, err := validateUserForm(r, form, form.Attributes)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	if formErrors != nil {
 		w.WriteHeader(422)
 		render.JSON(w, r, formErrors)
@@ -111,37 +327,170 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	}
 	user := schemas.User{}
 	hash, _ := bcrypt.GenerateFromPassword([]byte(form.Password), 10)
-	result, err := mongodb.GetCollection(user).InsertOne(r.Context(), schemas.User{
-		Email:    form.Email,
-		Password: string(hash),
-		FullName: form.FullName,
-		Address:  form.Address,
-		Desc:     form.Desc,
-		JoinTime: time.Now().Unix(),
-	})
+	result, err := mongodb.GetCollection(user).InsertOne(r.Context(), services.SearchableUser(models.User{
+		User: schemas.User{
+			Email:    form.Email,
+			Password: string(hash),
+			FullName: form.FullName,
+			Address:  form.Address,
+			Desc:     form.Desc,
+			JoinTime: time.Now().Unix(),
+		},
+		Attributes: attributes,
+		Tags:       helpers.NormalizeTags(form.Tags),
+	}))
+	if mongo.IsDuplicateKeyError(err) {
+		w.WriteHeader(422)
+		render.JSON(w, r, render.M{"email": helpers.Translate(r.Context(), "emailTaken")})
+		return
+	}
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	renderUser(w, r, result.InsertedID.(primitive.ObjectID))
+}
+
+// validateUserForm validates a user form along with its custom attribute
+// values, returning the attributes to store and the errors of both.
+func validateUserForm(r *http.Request, form interface{}, input map[string]interface{}) (bson.M, map[string]string, error) {
+	attributes, attributeErrors, err := services.ValidateAttributes(r.Context(), input)
+	if err != nil {
+		return nil, nil, err
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors == nil && attributeErrors == nil {
+		return attributes, nil, nil
+	}
+	errs := map[string]string{}
+	for key, value := range formErrors {
+		errs[key] = value
+	}
+	for key, value := range attributeErrors {
+		errs[key] = value
+	}
+	return nil, errs, nil
+}
+
+// userHistoryFields are the fields of a user tracked by the change history.
+func userHistoryFields(user models.User) bson.M {
+	attributes := user.Attributes
+	if attributes == nil {
+		attributes = bson.M{}
+	}
+	groupIDs := user.GroupIDs
+	if groupIDs == nil {
+		groupIDs = []primitive.ObjectID{}
+	}
+	tags := user.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return bson.M{
+		"fullName":   user.FullName,
+		"address":    user.Address,
+		"desc":       user.Desc,
+		"deleteTime": user.DeleteTime,
+		"attributes": attributes,
+		"groupIds":   groupIDs,
+		"tags":       tags,
+	}
+}
+
+// recordUserHistory logs instead of failing the request, the change itself
+// has already been written.
+func recordUserHistory(r *http.Request, user models.User, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.UserCollection, user.ID, action, userHistoryFields(user), update)
+	if err != nil {
+		log.Println("record user history:", err)
+	}
+}
+
+// updateUsers applies the update returned by change to every user matching
+// filter within the scope of the current admin, one document at a time so
+// that versions and history stay accurate. A nil update skips the user, as do
+// concurrent writes. Deletions skip the current user and any that would leave
+// no active superadmin. It returns how many users were updated.
+func updateUsers(r *http.Request, filter bson.M, action string, change func(user models.User) bson.M) (int, error) {
+	db := mongodb.GetCollection(schemas.User{})
+	cursor, err := db.Find(r.Context(), services.ScopeUsers(r.Context(), filter))
+	if err != nil {
+		return 0, err
+	}
+	users := []models.User{}
+	err = cursor.All(r.Context(), &users)
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, user := range users {
+		updateData := change(user)
+		if updateData == nil {
+			continue
+		}
+		var result *mongo.UpdateResult
+		if action == services.HistoryActionDelete {
+			if services.CheckSelf(r.Context(), user.ID) != nil {
+				continue
+			}
+			result, err = services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+				return helpers.UpdateVersion(ctx, db, user.ID, user.Version, bson.M{"$set": updateData})
+			})
+			if errors.Is(err, services.ErrLastSuperAdmin) {
+				continue
+			}
+		} else {
+			result, err = helpers.UpdateVersion(r.Context(), db, user.ID, user.Version, bson.M{"$set": updateData})
+		}
+		if err != nil {
+			return updated, err
+		}
+		if result.MatchedCount == 0 {
+			continue
+		}
+		recordUserHistory(r, user, action, updateData)
+		updated++
+	}
+	return updated, nil
+}
+
+// renderUser responds with the current state of a user along with its ETag.
+func renderUser(w http.ResponseWriter, r *http.Request, id primitive.ObjectID) {
+	user := models.User{}
+	err := mongodb.GetCollection(user.User).FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	helpers.SetETag(w, user.Version)
+	render.JSON(w, r, responses.NewUser(r.Context(), user))
 }
 
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var form struct {
-		ID       string `json:"id" validate:"required"`
-		Password string `json:"password" validate:"omitempty,omitnil,min=7,max=50"`
-		FullName string `json:"fullName" validate:"required,max=50"`
-		Address  string `json:"address" validate:"required,max=250"`
-		Desc     string `json:"desc" validate:"max=1000"`
+		ID       string   `json:"id" validate:"required"`
+		Password string   `json:"password" validate:"omitempty,omitnil,min=7,max=50"`
+		FullName string   `json:"fullName" validate:"required,max=50"`
+		Address  string   `json:"address" validate:"required,max=250"`
+		Desc     string   `json:"desc" validate:"max=1000"`
+		Tags     []string `json:"tags" validate:"max=20,dive,max=50"`
+
+		Attributes map[string]interface{} `json:"attributes"`
 	}
 	err := decoder.Decode(&form)
 	if err != nil {
 		w.WriteHeader(400)
 		return
 	}
-	formErrors := helpers.ValidateStruct(r.Context(), form)
+	attributes, formErrors, err := validateUserForm(r, form, form.Attributes)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	if formErrors != nil {
 		w.WriteHeader(422)
 		render.JSON(w, r, formErrors)
@@ -153,50 +502,203 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(err.Error()))
 		return
 	}
-	user := schemas.User{}
-	db := mongodb.GetCollection(user)
-	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
+	db.FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&user)
 	if user.ID.IsZero() {
 		w.WriteHeader(404)
 		return
 	}
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
 	updateData := bson.M{
-		"fullName": form.FullName,
-		"address":  form.Address,
-		"desc":     form.Desc,
+		"fullName":   form.FullName,
+		"address":    form.Address,
+		"desc":       form.Desc,
+		"search":     services.UserSearchFields(user.Email, form.FullName, form.Address),
+		"attributes": attributes,
+		"tags":       helpers.NormalizeTags(form.Tags),
 	}
 	if form.Password != "" {
 		hash, _ := bcrypt.GenerateFromPassword([]byte(form.Password), 10)
 		updateData["password"] = string(hash)
 	}
-	result, err := db.UpdateByID(r.Context(), id, bson.M{"$set": updateData})
+	result, err := helpers.UpdateVersion(r.Context(), db, id, user.Version, bson.M{"$set": updateData})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordUserHistory(r, user, services.HistoryActionUpdate, updateData)
+	renderUser(w, r, id)
 }
 
-func DeleteUser(w http.ResponseWriter, r *http.Request) {
+// Fields of a user that PATCH requests are allowed to change, tags being
+// admin labels users cannot set on their own profile.
+var (
+	userPatchFields    = []string{"fullName", "address", "desc", "tags"}
+	profilePatchFields = []string{"fullName", "address", "desc"}
+)
+
+func PatchUser(w http.ResponseWriter, r *http.Request) {
 	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
 	if err != nil {
 		w.WriteHeader(400)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	user := schemas.User{}
-	db := mongodb.GetCollection(user)
+	count, err := mongodb.GetCollection(schemas.User{}).CountDocuments(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id}))
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if count == 0 {
+		w.WriteHeader(404)
+		return
+	}
+	patchUser(w, r, id, userPatchFields)
+}
+
+// patchUser applies a JSON Merge Patch or a JSON Patch to the given fields
+// of a user, validates the result and writes only the changed fields.
+func patchUser(w http.ResponseWriter, r *http.Request, id primitive.ObjectID, fields []string) {
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
 	db.FindOne(r.Context(), bson.M{"_id": id}).Decode(&user)
 	if user.ID.IsZero() {
 		w.WriteHeader(404)
 		return
 	}
-	result, err := db.UpdateByID(r.Context(), id, bson.M{"$set": bson.M{"deleteTime": time.Now().Unix()}})
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
+	tags := []interface{}{}
+	for _, tag := range user.Tags {
+		tags = append(tags, tag)
+	}
+	patched, paths, err := helpers.ReadPatch(r, map[string]interface{}{
+		"fullName": user.FullName,
+		"address":  user.Address,
+		"desc":     user.Desc,
+		"tags":     tags,
+	})
+	switch {
+	case errors.Is(err, helpers.ErrUnsupportedPatch):
+		w.WriteHeader(415)
+		return
+	case errors.Is(err, helpers.ErrPatchTestFailed):
+		w.WriteHeader(409)
+		w.Write([]byte(err.Error()))
+		return
+	case err != nil:
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	for _, path := range paths {
+		if !slices.Contains(fields, path) {
+			w.WriteHeader(422)
+			render.JSON(w, r, render.M{path: helpers.Translate(r.Context(), "fieldNotPatchable")})
+			return
+		}
+	}
+
+	var form struct {
+		FullName string   `json:"fullName" validate:"required,max=50"`
+		Address  string   `json:"address" validate:"required,max=250"`
+		Desc     string   `json:"desc" validate:"max=1000"`
+		Tags     []string `json:"tags" validate:"max=20,dive,max=50"`
+	}
+	data, _ := json.Marshal(patched)
+	err = json.Unmarshal(data, &form)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+
+	updateData := bson.M{}
+	if form.FullName != user.FullName {
+		updateData["fullName"] = form.FullName
+	}
+	if form.Address != user.Address {
+		updateData["address"] = form.Address
+	}
+	if form.Desc != user.Desc {
+		updateData["desc"] = form.Desc
+	}
+	if tags := helpers.NormalizeTags(form.Tags); slices.Contains(fields, "tags") && !slices.Equal(tags, user.Tags) {
+		updateData["tags"] = tags
+	}
+	if len(updateData) == 0 {
+		renderUser(w, r, id)
+		return
+	}
+	if updateData["fullName"] != nil || updateData["address"] != nil {
+		updateData["search"] = services.UserSearchFields(user.Email, form.FullName, form.Address)
+	}
+	result, err := helpers.UpdateVersion(r.Context(), db, id, user.Version, bson.M{"$set": updateData})
 	if err != nil {
 		w.WriteHeader(500)
 		w.Write([]byte(err.Error()))
 		return
 	}
-	render.JSON(w, r, result)
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordUserHistory(r, user, services.HistoryActionUpdate, updateData)
+	renderUser(w, r, id)
+}
+
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := primitive.ObjectIDFromHex(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	user := models.User{}
+	db := mongodb.GetCollection(user.User)
+	db.FindOne(r.Context(), services.ScopeUsers(r.Context(), bson.M{"_id": id})).Decode(&user)
+	if user.ID.IsZero() {
+		w.WriteHeader(404)
+		return
+	}
+	if lockoutConflict(w, r, services.CheckSelf(r.Context(), id)) {
+		return
+	}
+	if helpers.PreconditionFailed(w, r, user.Version) {
+		return
+	}
+	updateData := bson.M{"deleteTime": time.Now().Unix()}
+	result, err := services.GuardAdmins(r.Context(), func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+		return helpers.UpdateVersion(ctx, db, id, user.Version, bson.M{"$set": updateData})
+	})
+	if lockoutConflict(w, r, err) {
+		return
+	}
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if result.MatchedCount == 0 {
+		w.WriteHeader(412)
+		return
+	}
+	recordUserHistory(r, user, services.HistoryActionDelete, updateData)
+	renderUser(w, r, id)
 }
@@ -0,0 +1,275 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/responses"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/schemas"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListUser query parameters a view may store. Paging parameters stay with
+// each request.
+var viewQueryParams = []string{
+	"status", "keyword", "group", "tag", "tz", "sort", "pageSize",
+	"joinedAfter", "joinedBefore", "deletedAfter", "deletedBefore", "lastLoginBefore",
+}
+
+// User fields a view may show as columns, besides "attributes.<key>".
+var viewColumns = []string{
+	"id", "email", "fullName", "address", "desc", "joinTime", "deleteTime",
+	"lastLoginTime", "avatar", "groupIds", "tags",
+}
+
+// viewFilter matches the views the current admin owns or that are shared with
+// one of their roles.
+func viewFilter(r *http.Request) bson.M {
+	user, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	admin, _ := r.Context().Value(enum.ContextKeyAdmin).(models.Admin)
+	or := bson.A{bson.M{"ownerId": user.ID}}
+	if len(admin.Roles) > 0 {
+		or = append(or, bson.M{"sharedRoles": bson.M{"$in": admin.Roles}})
+	}
+	return bson.M{"$or": or}
+}
+
+// findView loads a view the current admin can use, writing the error
+// response and returning false when there is none.
+func findView(w http.ResponseWriter, r *http.Request, id string) (models.View, bool) {
+	view := models.View{}
+	viewID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return view, false
+	}
+	filter := viewFilter(r)
+	filter["_id"] = viewID
+	models.Collection(models.ViewCollection).FindOne(r.Context(), filter).Decode(&view)
+	if view.ID.IsZero() {
+		w.WriteHeader(404)
+		return view, false
+	}
+	return view, true
+}
+
+// findOwnView is findView for changes, only the owner may change a view.
+func findOwnView(w http.ResponseWriter, r *http.Request) (models.View, bool) {
+	view, ok := findView(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return view, false
+	}
+	user, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	if view.OwnerID != user.ID {
+		w.WriteHeader(403)
+		return view, false
+	}
+	return view, true
+}
+
+// withViewQuery returns a copy of r whose query is the stored query of the
+// view, overridden by the parameters of r itself.
+func withViewQuery(r *http.Request, view models.View) *http.Request {
+	query := url.Values{}
+	for key, values := range view.Query {
+		query[key] = values
+	}
+	for key, values := range r.URL.Query() {
+		query[key] = values
+	}
+	r = r.Clone(r.Context())
+	r.URL.RawQuery = query.Encode()
+	return r
+}
+
+// validateView checks the query of a view the same way ListUser checks ad-hoc
+// filters, along with its columns.
+func validateView(r *http.Request, form interface{}, query url.Values, columns []string) map[string]string {
+	formErrors := helpers.ValidateStruct(r.Context(), form)
+	if formErrors == nil {
+		formErrors = map[string]string{}
+	}
+	for key := range query {
+		if !slices.Contains(viewQueryParams, key) && !strings.HasPrefix(key, "attr.") {
+			formErrors["query."+key] = helpers.Translate(r.Context(), "invalidViewQuery")
+		}
+	}
+	if _, _, err := userListFilter(r.Context(), query); err != nil {
+		formErrors["query"] = helpers.Translate(r.Context(), "invalidViewQuery")
+	}
+	if _, err := userListSort(query); err != nil {
+		formErrors["query.sort"] = helpers.Translate(r.Context(), "invalidViewQuery")
+	}
+	for _, column := range columns {
+		if !slices.Contains(viewColumns, column) && !strings.HasPrefix(column, "attributes.") {
+			formErrors["columns"] = helpers.Translate(r.Context(), "invalidViewColumn")
+		}
+	}
+	if len(formErrors) == 0 {
+		return nil
+	}
+	return formErrors
+}
+
+func ListView(w http.ResponseWriter, r *http.Request) {
+	opts := options.FindOptions{Sort: bson.D{{Key: "name", Value: 1}}}
+	cursor, err := models.Collection(models.ViewCollection).Find(r.Context(), viewFilter(r), &opts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	views := []models.View{}
+	err = cursor.All(r.Context(), &views)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	render.JSON(w, r, render.M{"items": responses.NewViews(views)})
+}
+
+func GetView(w http.ResponseWriter, r *http.Request) {
+	view, ok := findView(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	render.JSON(w, r, responses.NewView(view))
+}
+
+func viewHistoryFields(view models.View) bson.M {
+	query := view.Query
+	if query == nil {
+		query = map[string][]string{}
+	}
+	columns := view.Columns
+	if columns == nil {
+		columns = []string{}
+	}
+	sharedRoles := view.SharedRoles
+	if sharedRoles == nil {
+		sharedRoles = []string{}
+	}
+	return bson.M{
+		"name":        view.Name,
+		"query":       query,
+		"columns":     columns,
+		"sharedRoles": sharedRoles,
+	}
+}
+
+func recordViewHistory(r *http.Request, view models.View, action string, update bson.M) {
+	err := services.RecordHistory(r.Context(), models.ViewCollection, view.ID, action, viewHistoryFields(view), update)
+	if err != nil {
+		log.Println("record view history:", err)
+	}
+}
+
+func CreateView(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Name        string              `json:"name" validate:"required,max=50"`
+		Query       map[string][]string `json:"query" validate:"max=30"`
+		Columns     []string            `json:"columns" validate:"max=50"`
+		SharedRoles []string            `json:"sharedRoles" validate:"dive,role"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := validateView(r, form, form.Query, form.Columns)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	user, _ := r.Context().Value(enum.ContextKeyUser).(schemas.User)
+	now := time.Now().Unix()
+	view := models.View{
+		OwnerID:     user.ID,
+		Name:        form.Name,
+		Query:       form.Query,
+		Columns:     form.Columns,
+		SharedRoles: form.SharedRoles,
+		CreateTime:  now,
+		UpdateTime:  now,
+	}
+	result, err := models.Collection(models.ViewCollection).InsertOne(r.Context(), view)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	view.ID = result.InsertedID.(primitive.ObjectID)
+	recordViewHistory(r, models.View{ID: view.ID}, services.HistoryActionCreate, viewHistoryFields(view))
+	render.JSON(w, r, responses.NewView(view))
+}
+
+func UpdateView(w http.ResponseWriter, r *http.Request) {
+	view, ok := findOwnView(w, r)
+	if !ok {
+		return
+	}
+	decoder := json.NewDecoder(r.Body)
+	var form struct {
+		Name        string              `json:"name" validate:"required,max=50"`
+		Query       map[string][]string `json:"query" validate:"max=30"`
+		Columns     []string            `json:"columns" validate:"max=50"`
+		SharedRoles []string            `json:"sharedRoles" validate:"dive,role"`
+	}
+	err := decoder.Decode(&form)
+	if err != nil {
+		w.WriteHeader(400)
+		return
+	}
+	formErrors := validateView(r, form, form.Query, form.Columns)
+	if formErrors != nil {
+		w.WriteHeader(422)
+		render.JSON(w, r, formErrors)
+		return
+	}
+	before := view
+	view.Name = form.Name
+	view.Query = form.Query
+	view.Columns = form.Columns
+	view.SharedRoles = form.SharedRoles
+	view.UpdateTime = time.Now().Unix()
+	_, err = models.Collection(models.ViewCollection).ReplaceOne(r.Context(), bson.M{"_id": view.ID}, view)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordViewHistory(r, before, services.HistoryActionUpdate, viewHistoryFields(view))
+	render.JSON(w, r, responses.NewView(view))
+}
+
+func DeleteView(w http.ResponseWriter, r *http.Request) {
+	view, ok := findOwnView(w, r)
+	if !ok {
+		return
+	}
+	_, err := models.Collection(models.ViewCollection).DeleteOne(r.Context(), bson.M{"_id": view.ID})
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	recordViewHistory(r, view, services.HistoryActionDelete, viewHistoryFields(models.View{}))
+	w.WriteHeader(204)
+}
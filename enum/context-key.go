@@ -3,6 +3,12 @@ package enum
 type contextKey int
 
 const (
-	ContextKeyLocale contextKey = 1
-	ContextKeyUser   contextKey = 2
+	ContextKeyLocale       contextKey = 1
+	ContextKeyUser         contextKey = 2
+	ContextKeyAdmin        contextKey = 3
+	ContextKeyPermissions  contextKey = 4
+	ContextKeyApproval     contextKey = 5
+	ContextKeyAudit        contextKey = 6
+	ContextKeyImpersonator contextKey = 7
+	ContextKeyAPIKey       contextKey = 8
 )
@@ -0,0 +1,21 @@
+package enum
+
+const (
+	PermissionUserRead       = "user.read"
+	PermissionUserWrite      = "user.write"
+	PermissionUserDelete     = "user.delete"
+	PermissionUserEmail      = "user.email"
+	PermissionUserHistory    = "user.history"
+	PermissionUserExport     = "user.export"
+	PermissionUserErase      = "user.erase"
+	PermissionUserMerge      = "user.merge"
+	PermissionAdminRead      = "admin.read"
+	PermissionAdminWrite     = "admin.write"
+	PermissionRoleRead       = "role.read"
+	PermissionRoleWrite      = "role.write"
+	PermissionAttributeWrite = "attribute.write"
+	PermissionGroupWrite     = "group.write"
+	PermissionStatsRead      = "stats.read"
+	PermissionReviewWrite    = "review.write"
+	PermissionAuditRead      = "audit.read"
+)
@@ -0,0 +1,8 @@
+package enum
+
+// Built-in roles, see models.BuiltInRoles.
+const (
+	RoleSuperAdmin = "superadmin"
+	RoleAdmin      = "admin"
+	RoleViewer     = "viewer"
+)
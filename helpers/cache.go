@@ -0,0 +1,50 @@
+package helpers
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry[T any] struct {
+	value  T
+	expire time.Time
+}
+
+// Cache is an in-memory cache whose entries expire after TTL. A zero TTL
+// disables caching.
+type Cache[T any] struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry[T]
+}
+
+func (c *Cache[T]) Get(key string) (T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expire) {
+		delete(c.entries, key)
+		var zero T
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *Cache[T]) Set(key string, value T) {
+	if c.TTL <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]cacheEntry[T]{}
+	}
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expire) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[key] = cacheEntry[T]{value: value, expire: now.Add(c.TTL)}
+}
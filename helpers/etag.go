@@ -0,0 +1,70 @@
+package helpers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ETag formats a document version, documents written before versioning
+// existed have version 0.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+func SetETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", ETag(version))
+}
+
+func matchETag(header string, version int64, weak bool) bool {
+	etag := ETag(version)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified sets the ETag of the document and reports whether If-None-Match
+// already matches it, in which case a 304 has been written.
+func NotModified(w http.ResponseWriter, r *http.Request, version int64) bool {
+	SetETag(w, version)
+	header := r.Header.Get("If-None-Match")
+	if header != "" && matchETag(header, version, true) {
+		w.WriteHeader(304)
+		return true
+	}
+	return false
+}
+
+// PreconditionFailed reports whether the request carries an If-Match header
+// that does not match the current version, in which case a 412 has been written.
+func PreconditionFailed(w http.ResponseWriter, r *http.Request, version int64) bool {
+	header := r.Header.Get("If-Match")
+	if header != "" && !matchETag(header, version, false) {
+		w.WriteHeader(412)
+		return true
+	}
+	return false
+}
+
+// UpdateVersion applies update only if the document is still at version and
+// bumps the version. A zero MatchedCount means a concurrent write won.
+func UpdateVersion(ctx context.Context, db *mongo.Collection, id primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error) {
+	filter := bson.M{"_id": id, "version": version}
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+	update["$inc"] = bson.M{"version": 1}
+	return db.UpdateOne(ctx, filter, update)
+}
@@ -0,0 +1,71 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{`"1", "3"`, true},
+		{"*", true},
+		{`"2"`, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/user/1", nil)
+		if tt.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		got := NotModified(w, r, 3)
+		if got != tt.want {
+			t.Errorf("If-None-Match %s: NotModified = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+		if tt.want && w.Code != 304 {
+			t.Errorf("If-None-Match %s: status = %d, want 304", tt.ifNoneMatch, w.Code)
+		}
+		if etag := w.Header().Get("ETag"); etag != `"3"` {
+			t.Errorf("ETag = %s, want \"3\"", etag)
+		}
+	}
+}
+
+func TestPreconditionFailed(t *testing.T) {
+	tests := []struct {
+		ifMatch string
+		want    bool
+	}{
+		{"", false},
+		{`"3"`, false},
+		{`"1", "3"`, false},
+		{"*", false},
+		{`"2"`, true},
+		{`W/"3"`, true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("PUT", "/user/1", nil)
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+		got := PreconditionFailed(w, r, 3)
+		if got != tt.want {
+			t.Errorf("If-Match %s: PreconditionFailed = %v, want %v", tt.ifMatch, got, tt.want)
+		}
+		if tt.want && w.Code != 412 {
+			t.Errorf("If-Match %s: status = %d, want 412", tt.ifMatch, w.Code)
+		}
+	}
+}
+
+func TestETagOfUnversionedDocument(t *testing.T) {
+	if got := ETag(0); got != `"0"` {
+		t.Errorf("ETag(0) = %s", got)
+	}
+}
@@ -0,0 +1,152 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor points at a document in a collection sorted by (joinTime, _id) descending.
+type Cursor struct {
+	JoinTime int64              `json:"t"`
+	ID       primitive.ObjectID `json:"i"`
+}
+
+// Keyset holds the parsed cursor pagination parameters of a request.
+type Keyset struct {
+	Cursor *Cursor
+	Before bool
+	Limit  int64
+}
+
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c := Cursor{}
+	if json.Unmarshal(data, &c) != nil || c.ID.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// IsKeysetRequest reports whether the caller asked for cursor pagination
+// instead of the classic page/pageSize one.
+func IsKeysetRequest(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("after") || q.Has("before") || q.Has("limit")
+}
+
+func ParseKeyset(r *http.Request) (*Keyset, error) {
+	q := r.URL.Query()
+	ks := Keyset{Limit: StringToInt64(q.Get("limit"), 50)}
+	if ks.Limit < 1 || ks.Limit > 500 {
+		ks.Limit = 50
+	}
+	raw := q.Get("after")
+	if q.Get("before") != "" {
+		raw = q.Get("before")
+		ks.Before = true
+	}
+	if raw != "" {
+		c, err := DecodeCursor(raw)
+		if err != nil {
+			return nil, err
+		}
+		ks.Cursor = c
+	}
+	return &ks, nil
+}
+
+// Filter returns the condition selecting documents past the cursor.
+func (ks *Keyset) Filter() bson.M {
+	if ks.Cursor == nil {
+		return bson.M{}
+	}
+	op := "$lt"
+	if ks.Before {
+		op = "$gt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{"joinTime": bson.M{op: ks.Cursor.JoinTime}},
+		bson.M{"joinTime": ks.Cursor.JoinTime, "_id": bson.M{op: ks.Cursor.ID}},
+	}}
+}
+
+// Sort walks backwards when paging to the previous page, results must then be
+// reversed with Page.
+func (ks *Keyset) Sort() bson.D {
+	dir := -1
+	if ks.Before {
+		dir = 1
+	}
+	return bson.D{{Key: "joinTime", Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// Page trims the extra probe item fetched with limit+1, restores the display
+// order and returns the next and previous cursors.
+func Page[T any](ks *Keyset, items []T, cursorOf func(T) Cursor) (page []T, next string, prev string) {
+	more := int64(len(items)) > ks.Limit
+	if more {
+		items = items[:ks.Limit]
+	}
+	if ks.Before {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if len(items) == 0 {
+		return items, "", ""
+	}
+	hasNext, hasPrev := more, ks.Cursor != nil
+	if ks.Before {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		next = EncodeCursor(cursorOf(items[len(items)-1]))
+	}
+	if hasPrev {
+		prev = EncodeCursor(cursorOf(items[0]))
+	}
+	return items, next, prev
+}
+
+// SetLinkHeader writes RFC 8288 next/prev links pointing at the current URL.
+func SetLinkHeader(w http.ResponseWriter, r *http.Request, next string, prev string) {
+	links := []string{}
+	for _, link := range [][2]string{{"next", next}, {"prev", prev}} {
+		rel, cursor := link[0], link[1]
+		if cursor == "" {
+			continue
+		}
+		u := *r.URL
+		q := u.Query()
+		q.Del("after")
+		q.Del("before")
+		q.Del("page")
+		if rel == "next" {
+			q.Set("after", cursor)
+		} else {
+			q.Set("before", cursor)
+		}
+		u.RawQuery = q.Encode()
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
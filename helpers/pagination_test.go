@@ -0,0 +1,124 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	c := Cursor{JoinTime: 1700000000, ID: primitive.NewObjectID()}
+	got, err := DecodeCursor(EncodeCursor(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != c {
+		t.Errorf("DecodeCursor = %+v, want %+v", *got, c)
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	for _, raw := range []string{"", "!!!", "bm90IGpzb24", EncodeCursor(Cursor{JoinTime: 1})} {
+		if _, err := DecodeCursor(raw); err != ErrInvalidCursor {
+			t.Errorf("DecodeCursor(%q) error = %v, want ErrInvalidCursor", raw, err)
+		}
+	}
+}
+
+func TestParseKeyset(t *testing.T) {
+	c := Cursor{JoinTime: 5, ID: primitive.NewObjectID()}
+	tests := []struct {
+		query  string
+		before bool
+		limit  int64
+		cursor bool
+	}{
+		{"limit=20", false, 20, false},
+		{"limit=0", false, 50, false},
+		{"limit=1000", false, 50, false},
+		{"after=" + EncodeCursor(c), false, 50, true},
+		{"before=" + EncodeCursor(c) + "&limit=10", true, 10, true},
+	}
+	for _, tt := range tests {
+		ks, err := ParseKeyset(httptest.NewRequest("GET", "/user?"+tt.query, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if ks.Before != tt.before || ks.Limit != tt.limit || (ks.Cursor != nil) != tt.cursor {
+			t.Errorf("%s: got %+v", tt.query, ks)
+		}
+	}
+	if _, err := ParseKeyset(httptest.NewRequest("GET", "/user?after=bad", nil)); err != ErrInvalidCursor {
+		t.Errorf("bad cursor error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestPage(t *testing.T) {
+	cursorOf := func(n int) Cursor { return Cursor{JoinTime: int64(n), ID: primitive.NewObjectID()} }
+	joinTime := func(raw string) int64 {
+		c, err := DecodeCursor(raw)
+		if err != nil {
+			return -1
+		}
+		return c.JoinTime
+	}
+
+	// First page, newest first, with one more item than the limit.
+	items, next, prev := Page(&Keyset{Limit: 2}, []int{9, 8, 7}, cursorOf)
+	if !reflect.DeepEqual(items, []int{9, 8}) || joinTime(next) != 8 || prev != "" {
+		t.Errorf("first page = %v, next %d, prev %q", items, joinTime(next), prev)
+	}
+
+	// Next page, the last one.
+	after := &Keyset{Limit: 2, Cursor: &Cursor{JoinTime: 8}}
+	items, next, prev = Page(after, []int{7}, cursorOf)
+	if !reflect.DeepEqual(items, []int{7}) || next != "" || joinTime(prev) != 7 {
+		t.Errorf("last page = %v, next %q, prev %d", items, next, joinTime(prev))
+	}
+
+	// Previous page, fetched oldest first and shown newest first.
+	before := &Keyset{Limit: 2, Before: true, Cursor: &Cursor{JoinTime: 7}}
+	items, next, prev = Page(before, []int{8, 9, 10}, cursorOf)
+	if !reflect.DeepEqual(items, []int{9, 8}) || joinTime(next) != 8 || joinTime(prev) != 9 {
+		t.Errorf("previous page = %v, next %d, prev %d", items, joinTime(next), joinTime(prev))
+	}
+
+	items, next, prev = Page(&Keyset{Limit: 2}, []int{}, cursorOf)
+	if len(items) != 0 || next != "" || prev != "" {
+		t.Errorf("empty page = %v, next %q, prev %q", items, next, prev)
+	}
+}
+
+func TestKeysetFilterAndSort(t *testing.T) {
+	ks := &Keyset{Limit: 10}
+	if len(ks.Filter()) != 0 {
+		t.Errorf("filter without cursor = %v", ks.Filter())
+	}
+	ks.Cursor = &Cursor{JoinTime: 5, ID: primitive.NewObjectID()}
+	if !strings.Contains(fmt.Sprint(ks.Filter()), "$lt") || ks.Sort()[0].Value != -1 {
+		t.Errorf("after: filter %v, sort %v", ks.Filter(), ks.Sort())
+	}
+	ks.Before = true
+	if !strings.Contains(fmt.Sprint(ks.Filter()), "$gt") || ks.Sort()[0].Value != 1 {
+		t.Errorf("before: filter %v, sort %v", ks.Filter(), ks.Sort())
+	}
+}
+
+func TestSetLinkHeader(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/user?status=active&after=old&page=3", nil)
+	SetLinkHeader(w, r, "N", "P")
+	want := `</user?after=N&status=active>; rel="next", </user?before=P&status=active>; rel="prev"`
+	if got := w.Header().Get("Link"); got != want {
+		t.Errorf("Link = %s, want %s", got, want)
+	}
+	w = httptest.NewRecorder()
+	SetLinkHeader(w, r, "", "")
+	if got := w.Header().Get("Link"); got != "" {
+		t.Errorf("Link without cursors = %s", got)
+	}
+}
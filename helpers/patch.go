@@ -0,0 +1,322 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	ContentTypeMergePatch = "application/merge-patch+json"
+	ContentTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	ErrPatchTestFailed     = errors.New("patch test operation failed")
+	ErrUnsupportedPatch    = errors.New("unsupported patch media type")
+	ErrPatchNotAnObject    = errors.New("merge patch must be a JSON object")
+	ErrPatchDocumentFormat = errors.New("patched document is not an object")
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation.
+type PatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from"`
+	Value interface{} `json:"value"`
+}
+
+// ApplyMergePatch applies an RFC 7396 JSON Merge Patch to doc and returns the
+// patched document, doc itself is left untouched.
+func ApplyMergePatch(doc interface{}, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	docObj, ok := doc.(map[string]interface{})
+	result := map[string]interface{}{}
+	if ok {
+		for key, value := range docObj {
+			result[key] = value
+		}
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		result[key] = ApplyMergePatch(result[key], value)
+	}
+	return result
+}
+
+// ApplyJSONPatch applies RFC 6902 operations in order, stopping at the first
+// failing one. doc itself is left untouched.
+func ApplyJSONPatch(doc map[string]interface{}, ops []PatchOperation) (map[string]interface{}, error) {
+	var result interface{} = deepCopy(doc)
+	var err error
+	for i, op := range ops {
+		result, err = applyOperation(result, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	obj, ok := result.(map[string]interface{})
+	if !ok {
+		return nil, ErrPatchDocumentFormat
+	}
+	return obj, nil
+}
+
+// ReadPatch decodes the request body as a merge patch or a JSON Patch, chosen
+// by Content-Type (plain JSON is treated as a merge patch), applies it to doc
+// and returns the result along with the top level members it touches.
+func ReadPatch(r *http.Request, doc map[string]interface{}) (map[string]interface{}, []string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	decoder := json.NewDecoder(r.Body)
+	switch mediaType {
+	case ContentTypeJSONPatch:
+		ops := []PatchOperation{}
+		if err := decoder.Decode(&ops); err != nil {
+			return nil, nil, err
+		}
+		patched, err := ApplyJSONPatch(doc, ops)
+		return patched, PatchPaths(ops), err
+	case ContentTypeMergePatch, "application/json", "":
+		var patch interface{}
+		if err := decoder.Decode(&patch); err != nil {
+			return nil, nil, err
+		}
+		obj, ok := patch.(map[string]interface{})
+		if !ok {
+			return nil, nil, ErrPatchNotAnObject
+		}
+		paths := []string{}
+		for key := range obj {
+			paths = append(paths, key)
+		}
+		return ApplyMergePatch(doc, obj).(map[string]interface{}), paths, nil
+	}
+	return nil, nil, ErrUnsupportedPatch
+}
+
+// PatchPaths returns the top level members touched by JSON Patch operations,
+// used to enforce field whitelists. Invalid and root pointers are returned as is.
+func PatchPaths(ops []PatchOperation) []string {
+	paths := []string{}
+	for _, op := range ops {
+		pointers := []string{op.Path}
+		if op.Op == "move" || op.Op == "copy" {
+			pointers = append(pointers, op.From)
+		}
+		for _, pointer := range pointers {
+			tokens, err := parsePointer(pointer)
+			if err != nil || len(tokens) == 0 {
+				paths = append(paths, pointer)
+				continue
+			}
+			paths = append(paths, tokens[0])
+		}
+	}
+	return paths
+}
+
+func applyOperation(doc interface{}, op PatchOperation) (interface{}, error) {
+	switch op.Op {
+	case "add":
+		return setPointer(doc, op.Path, deepCopy(op.Value), true)
+	case "remove":
+		doc, _, err := removePointer(doc, op.Path)
+		return doc, err
+	case "replace":
+		if _, err := getPointer(doc, op.Path); err != nil {
+			return nil, err
+		}
+		return setPointer(doc, op.Path, deepCopy(op.Value), false)
+	case "move":
+		if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, value, err := removePointer(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(doc, op.Path, value, true)
+	case "copy":
+		value, err := getPointer(doc, op.From)
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(doc, op.Path, deepCopy(value), true)
+	case "test":
+		value, err := getPointer(doc, op.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(normalizeNumbers(value), normalizeNumbers(op.Value)) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > length || (!allowEnd && index == length) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return index, nil
+}
+
+func getPointer(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	current := doc
+	for _, token := range tokens {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q does not exist", pointer)
+			}
+			current = value
+		case []interface{}:
+			index, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path %q does not exist", pointer)
+		}
+	}
+	return current, nil
+}
+
+// setPointer adds (insert) or replaces the value at pointer and returns the
+// new document root.
+func setPointer(doc interface{}, pointer string, value interface{}, insert bool) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, err := getPointer(doc, parentPointer)
+	if err != nil {
+		return nil, err
+	}
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		index, err := arrayIndex(last, len(node), insert)
+		if err != nil {
+			return nil, err
+		}
+		if insert {
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+		}
+		node[index] = value
+		return setPointer(doc, parentPointer, node, false)
+	}
+	return nil, fmt.Errorf("path %q does not exist", pointer)
+}
+
+func removePointer(doc interface{}, pointer string) (interface{}, interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, errors.New("cannot remove the document root")
+	}
+	value, err := getPointer(doc, pointer)
+	if err != nil {
+		return nil, nil, err
+	}
+	parentPointer := pointer[:strings.LastIndex(pointer, "/")]
+	parent, _ := getPointer(doc, parentPointer)
+	last := tokens[len(tokens)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		delete(node, last)
+		return doc, value, nil
+	case []interface{}:
+		index, _ := arrayIndex(last, len(node), false)
+		node = append(node[:index:index], node[index+1:]...)
+		doc, err = setPointer(doc, parentPointer, node, false)
+		return doc, value, err
+	}
+	return nil, nil, fmt.Errorf("path %q does not exist", pointer)
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = deepCopy(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = deepCopy(item)
+		}
+		return result
+	}
+	return value
+}
+
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = normalizeNumbers(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = normalizeNumbers(item)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,159 @@
+package helpers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"fullName": "Jane",
+		"address":  "Here",
+		"attributes": map[string]interface{}{
+			"team": "a",
+			"size": 3.0,
+		},
+	}
+	patch := map[string]interface{}{
+		"fullName":   "Jane Doe",
+		"address":    nil,
+		"attributes": map[string]interface{}{"team": "b", "size": nil},
+	}
+	want := map[string]interface{}{
+		"fullName":   "Jane Doe",
+		"attributes": map[string]interface{}{"team": "b"},
+	}
+	if got := ApplyMergePatch(doc, patch); !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyMergePatch = %v, want %v", got, want)
+	}
+	if doc["fullName"] != "Jane" || doc["address"] != "Here" {
+		t.Errorf("ApplyMergePatch changed its input: %v", doc)
+	}
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"fullName": "Jane",
+		"tags":     []interface{}{"a", "b"},
+		"a/b":      "slash",
+	}
+	tests := []struct {
+		name string
+		ops  []PatchOperation
+		want map[string]interface{}
+		err  error
+	}{
+		{
+			name: "add and replace",
+			ops: []PatchOperation{
+				{Op: "add", Path: "/desc", Value: "hi"},
+				{Op: "replace", Path: "/fullName", Value: "Jane Doe"},
+			},
+			want: map[string]interface{}{"fullName": "Jane Doe", "desc": "hi", "tags": []interface{}{"a", "b"}, "a/b": "slash"},
+		},
+		{
+			name: "array insert, append and remove",
+			ops: []PatchOperation{
+				{Op: "add", Path: "/tags/0", Value: "z"},
+				{Op: "add", Path: "/tags/-", Value: "c"},
+				{Op: "remove", Path: "/tags/1"},
+			},
+			want: map[string]interface{}{"fullName": "Jane", "tags": []interface{}{"z", "b", "c"}, "a/b": "slash"},
+		},
+		{
+			name: "move, copy and escaped pointer",
+			ops: []PatchOperation{
+				{Op: "move", From: "/a~1b", Path: "/desc"},
+				{Op: "copy", From: "/fullName", Path: "/address"},
+			},
+			want: map[string]interface{}{"fullName": "Jane", "address": "Jane", "desc": "slash", "tags": []interface{}{"a", "b"}},
+		},
+		{
+			name: "passing test",
+			ops:  []PatchOperation{{Op: "test", Path: "/tags", Value: []interface{}{"a", "b"}}},
+			want: doc,
+		},
+		{
+			name: "failing test stops the patch",
+			ops: []PatchOperation{
+				{Op: "replace", Path: "/fullName", Value: "X"},
+				{Op: "test", Path: "/fullName", Value: "Jane"},
+			},
+			err: ErrPatchTestFailed,
+		},
+		{name: "replace missing member", ops: []PatchOperation{{Op: "replace", Path: "/desc", Value: "x"}}, err: errAny},
+		{name: "remove root", ops: []PatchOperation{{Op: "remove", Path: ""}}, err: errAny},
+		{name: "out of range index", ops: []PatchOperation{{Op: "add", Path: "/tags/5", Value: "x"}}, err: errAny},
+		{name: "leading zero index", ops: []PatchOperation{{Op: "remove", Path: "/tags/01"}}, err: errAny},
+		{name: "move into child", ops: []PatchOperation{{Op: "move", From: "/tags", Path: "/tags/0"}}, err: errAny},
+		{name: "unknown op", ops: []PatchOperation{{Op: "merge", Path: "/fullName"}}, err: errAny},
+		{name: "root replaced by a non object", ops: []PatchOperation{{Op: "add", Path: "", Value: "x"}}, err: ErrPatchDocumentFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJSONPatch(doc, tt.ops)
+			switch {
+			case tt.err == errAny && err == nil:
+				t.Fatalf("ApplyJSONPatch = %v, want an error", got)
+			case tt.err != nil && tt.err != errAny && !errors.Is(err, tt.err):
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			case tt.err == nil && err != nil:
+				t.Fatal(err)
+			case tt.err == nil && !reflect.DeepEqual(got, tt.want):
+				t.Errorf("ApplyJSONPatch = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if doc["fullName"] != "Jane" || len(doc["tags"].([]interface{})) != 2 {
+		t.Errorf("ApplyJSONPatch changed its input: %v", doc)
+	}
+}
+
+var errAny = errors.New("any error")
+
+func TestPatchPaths(t *testing.T) {
+	got := PatchPaths([]PatchOperation{
+		{Op: "replace", Path: "/fullName/x"},
+		{Op: "move", From: "/password", Path: "/desc"},
+		{Op: "add", Path: ""},
+		{Op: "add", Path: "bad"},
+	})
+	want := []string{"fullName", "desc", "password", "", "bad"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PatchPaths = %q, want %q", got, want)
+	}
+}
+
+func TestReadPatch(t *testing.T) {
+	doc := map[string]interface{}{"fullName": "Jane", "address": "Here"}
+	tests := []struct {
+		contentType string
+		body        string
+		want        map[string]interface{}
+		paths       []string
+		err         error
+	}{
+		{"", `{"fullName":"Jane Doe"}`, map[string]interface{}{"fullName": "Jane Doe", "address": "Here"}, []string{"fullName"}, nil},
+		{ContentTypeMergePatch + "; charset=utf-8", `{"address":null,"desc":"x"}`, map[string]interface{}{"fullName": "Jane", "desc": "x"}, []string{"address", "desc"}, nil},
+		{ContentTypeJSONPatch, `[{"op":"replace","path":"/address","value":"There"}]`, map[string]interface{}{"fullName": "Jane", "address": "There"}, []string{"address"}, nil},
+		{ContentTypeMergePatch, `["fullName"]`, nil, nil, ErrPatchNotAnObject},
+		{"text/plain", `{}`, nil, nil, ErrUnsupportedPatch},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("PATCH", "/profile", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		got, paths, err := ReadPatch(r, doc)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s %s: error = %v, want %v", tt.contentType, tt.body, err, tt.err)
+			continue
+		}
+		sort.Strings(paths)
+		if !reflect.DeepEqual(got, tt.want) || !reflect.DeepEqual(paths, tt.paths) {
+			t.Errorf("%s %s: got %v %q, want %v %q", tt.contentType, tt.body, got, paths, tt.want, tt.paths)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package helpers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+)
+
+// HasPermission reports whether the admin acting in ctx holds permission.
+func HasPermission(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value(enum.ContextKeyPermissions).([]string)
+	return slices.Contains(permissions, permission)
+}
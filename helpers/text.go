@@ -3,6 +3,7 @@ package helpers
 import (
 	"context"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -12,26 +13,39 @@ import (
 	"github.com/go-playground/locales/en"
 	"github.com/go-playground/locales/vi"
 	ut "github.com/go-playground/universal-translator"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
 )
 
-func Translate(ctx context.Context, tag string) string {
+func Translate(ctx context.Context, tag string, params ...string) string {
+	return TranslateLocale(Locale(ctx), tag, params...)
+}
+
+// TranslateLocale translates into a given locale, such as the one an email
+// recipient chose, rather than the one of the request.
+func TranslateLocale(locale string, tag string, params ...string) string {
 	utrans := ut.New(en.New(), en.New(), vi.New())
 	utrans.Import(ut.FormatJSON, "translations")
 	utrans.VerifyTranslations()
 
-	locale := "en"
-	if ctx.Value(enum.ContextKeyLocale) != nil {
-		locale = ctx.Value(enum.ContextKeyLocale).(string)
-	}
-
 	trans, _ := utrans.GetTranslator(locale)
-	traslated, err := trans.T(tag)
+	traslated, err := trans.T(tag, params...)
 	if err != nil {
 		return tag
 	}
 	return traslated
 }
 
+// Locale returns the request locale set by middlewares.LocaleHeader.
+func Locale(ctx context.Context) string {
+	locale := "en"
+	if ctx.Value(enum.ContextKeyLocale) != nil {
+		locale = ctx.Value(enum.ContextKeyLocale).(string)
+	}
+	return locale
+}
+
 func LowerFirstChar(s string) string {
 	r, size := utf8.DecodeRuneInString(s)
 	if r == utf8.RuneError && size <= 1 {
@@ -62,3 +76,43 @@ func StringToInt64(str string, df int64) int64 {
 	}
 	return rs
 }
+
+// RemoveDiacritics strips accents so that "Nguyễn Đức" becomes "Nguyen Duc".
+func RemoveDiacritics(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	rs, _, err := transform.String(t, s)
+	if err != nil {
+		return s
+	}
+	return strings.NewReplacer("đ", "d", "Đ", "D").Replace(rs)
+}
+
+// NormalizeSearchText lowercases, removes diacritics and collapses whitespace.
+func NormalizeSearchText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(RemoveDiacritics(s))), " ")
+}
+
+// MaskEmail hides the local part of an email except its first character.
+func MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		at = len(email)
+	}
+	local := []rune(email[:at])
+	if len(local) <= 1 {
+		return strings.Repeat("*", len(local)) + email[at:]
+	}
+	return string(local[0]) + strings.Repeat("*", len(local)-1) + email[at:]
+}
+
+// NormalizeTags trims and lowercases tags, dropping empty and duplicate ones.
+func NormalizeTags(tags []string) []string {
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
@@ -0,0 +1,18 @@
+package helpers
+
+import "testing"
+
+func TestNormalizeSearchText(t *testing.T) {
+	tests := map[string]string{
+		"Nguyễn Văn Đức":      "nguyen van duc",
+		"  Trần   Thị\tHoa  ": "tran thi hoa",
+		"ĐÀ NẴNG":             "da nang",
+		"jane@example.com":    "jane@example.com",
+		"":                    "",
+	}
+	for input, want := range tests {
+		if got := NormalizeSearchText(input); got != want {
+			t.Errorf("NormalizeSearchText(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
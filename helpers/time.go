@@ -0,0 +1,35 @@
+package helpers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseTimeParam reads a time query parameter as unix seconds, as days
+// relative to now ("-30d") or as the start of the current "today", "week"
+// (Monday) or "month" in the location of now.
+func ParseTimeParam(value string, now time.Time) (int64, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch value {
+	case "today":
+		return today.Unix(), nil
+	case "week":
+		return today.AddDate(0, 0, -(int(today.Weekday())+6)%7).Unix(), nil
+	case "month":
+		return today.AddDate(0, 0, 1-today.Day()).Unix(), nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n > 0 {
+			return 0, fmt.Errorf("invalid relative time %q", value)
+		}
+		return now.AddDate(0, 0, n).Unix(), nil
+	}
+	unix, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return unix, nil
+}
@@ -2,26 +2,31 @@ package helpers
 
 import (
 	"context"
+	"strings"
 
-	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
 	enTranslation "github.com/anyshare/anyshare-admin-api/translations/en"
 	viTranslation "github.com/anyshare/anyshare-admin-api/translations/vi"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
 	"github.com/go-playground/locales/en"
 	"github.com/go-playground/locales/vi"
 	ut "github.com/go-playground/universal-translator"
 	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
-func ValidateStruct(ctx context.Context, data interface{}) validator.ValidationErrorsTranslations {
+// NewValidator returns a validator with the custom tags of this API and the
+// translator of the request locale registered.
+func NewValidator(ctx context.Context) (*validator.Validate, ut.Translator) {
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterValidationCtx("unique_email", uniqueEmail)
+	validate.RegisterValidationCtx("role", roleExists)
 	utrans := ut.New(en.New(), en.New(), vi.New())
 	utrans.Import(ut.FormatJSON, "translations")
 	utrans.VerifyTranslations()
 
-	locale := "en"
-	if ctx.Value(enum.ContextKeyLocale) != nil {
-		locale = ctx.Value(enum.ContextKeyLocale).(string)
-	}
+	locale := Locale(ctx)
 	trans, _ := utrans.GetTranslator(locale)
 
 	if locale == "vi" {
@@ -29,8 +34,13 @@ func ValidateStruct(ctx context.Context, data interface{}) validator.ValidationE
 	} else {
 		enTranslation.RegisterDefaultTranslations(validate, trans)
 	}
+	return validate, trans
+}
 
-	err := validate.Struct(data)
+func ValidateStruct(ctx context.Context, data interface{}) validator.ValidationErrorsTranslations {
+	validate, trans := NewValidator(ctx)
+
+	err := validate.StructCtx(ctx, data)
 	if err != nil {
 		errs := make(map[string]string)
 		for key, value := range err.(validator.ValidationErrors).Translate(trans) {
@@ -41,3 +51,27 @@ func ValidateStruct(ctx context.Context, data interface{}) validator.ValidationE
 	}
 	return nil
 }
+
+// NormalizeEmail returns the canonical form emails are stored and looked up in.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// uniqueEmail fails when any user, deleted or not, already has the email.
+func uniqueEmail(ctx context.Context, fl validator.FieldLevel) bool {
+	count, err := mongodb.GetCollection(schemas.User{}).CountDocuments(ctx, bson.M{
+		"email": NormalizeEmail(fl.Field().String()),
+	})
+	return err == nil && count == 0
+}
+
+// roleExists fails unless the field is the key of a built-in or custom role.
+func roleExists(ctx context.Context, fl validator.FieldLevel) bool {
+	if _, ok := models.BuiltInRole(fl.Field().String()); ok {
+		return true
+	}
+	count, err := models.Collection(models.RoleCollection).CountDocuments(ctx, bson.M{
+		"key": fl.Field().String(),
+	})
+	return err == nil && count > 0
+}
@@ -0,0 +1,15 @@
+package mail
+
+import (
+	"context"
+	"log"
+)
+
+// Log writes emails to the standard logger instead of sending them, for
+// development.
+type Log struct{}
+
+func (l *Log) Send(ctx context.Context, message Message) error {
+	log.Printf("mail to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
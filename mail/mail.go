@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"sync"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers plain text emails.
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+var (
+	defaultMailer Mailer
+	defaultOnce   sync.Once
+)
+
+// Default returns the mailer configured by MAIL_DRIVER, "log" (the default)
+// or "smtp".
+func Default() Mailer {
+	defaultOnce.Do(func() {
+		switch os.Getenv("MAIL_DRIVER") {
+		case "smtp":
+			defaultMailer = &SMTP{
+				Host:     os.Getenv("SMTP_HOST"),
+				Port:     os.Getenv("SMTP_PORT"),
+				Username: os.Getenv("SMTP_USERNAME"),
+				Password: os.Getenv("SMTP_PASSWORD"),
+				From:     os.Getenv("MAIL_FROM"),
+			}
+		default:
+			defaultMailer = &Log{}
+		}
+	})
+	return defaultMailer
+}
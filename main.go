@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -10,7 +12,10 @@ import (
 	"time"
 
 	"github.com/anyshare/anyshare-admin-api/api"
+	"github.com/anyshare/anyshare-admin-api/enum"
 	"github.com/anyshare/anyshare-admin-api/middlewares"
+	"github.com/anyshare/anyshare-admin-api/migrations"
+	"github.com/anyshare/anyshare-admin-api/services"
 	"github.com/anyshare/anyshare-common/mongodb"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,11 +26,31 @@ import (
 
 func main() {
 	godotenv.Load()
+	if len(os.Args) > 1 && os.Args[1] == "audit-verify" {
+		os.Exit(auditVerify(os.Args[2:]))
+	}
 	if os.Getenv("PORT") == "" {
 		panic("Cannot load app configuration, exit app!")
 	}
 
 	mongodb.Connect()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := migrations.Run(context.Background())
+		mongodb.Disconnect()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	go func() {
+		if err := services.BackfillUserSearch(context.Background()); err != nil {
+			log.Println("backfill user search:", err)
+		}
+	}()
+	go services.RunDuplicateDetection(context.Background(), duplicateScanInterval())
+	services.StartAuditWriter()
+	go services.RunAuditCheckpoints(context.Background(), auditCheckpointInterval())
+	go services.RunAccessReviews(context.Background(), accessReviewInterval(), accessReviewDuration())
 	r := initRouter()
 	setupAPI(r)
 	startServer(r)
@@ -42,12 +67,13 @@ func initRouter() *chi.Mux {
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	r.Use(middlewares.LocaleHeader)
+	r.Use(middlewares.Audit)
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag"},
 		AllowCredentials: false,
 		MaxAge:           300,
 	}))
@@ -58,25 +84,96 @@ func setupAPI(r *chi.Mux) {
 	//Public
 	r.Group(func(r chi.Router) {
 		r.Post("/login", api.Login)
+		r.Post("/invite/accept", api.AcceptInvitation)
+		r.Get("/avatars/{id}/{hash}/{size}", api.GetAvatar)
 	})
 	//Protected
 	r.Group(func(r chi.Router) {
 		r.Use(middlewares.Authentication)
+		can := middlewares.RequirePermission
+		r.With(can(enum.PermissionStatsRead)).Get("/stats", api.GetStats)
+		r.With(can(enum.PermissionAuditRead)).Get("/audit", api.ListAudit)
+		r.With(can(enum.PermissionAuditRead)).Get("/audit/verify", api.VerifyAudit)
+		r.With(can(enum.PermissionAuditRead)).Get("/audit/export", api.ExportAudit)
+		r.With(can(enum.PermissionAuditRead)).Get("/audit/history/{id}", api.GetAuditHistory)
+
 		r.Get("/profile", api.GetProfile)
 		r.Post("/profile", api.UpdateProfile)
+		r.Patch("/profile", api.PatchProfile)
 		r.Post("/profile/password", api.ChangePassword)
+		r.Post("/profile/avatar", api.UploadProfileAvatar)
+
+		r.With(can(enum.PermissionUserRead)).Get("/user", api.ListUser)
+		r.With(can(enum.PermissionUserMerge)).Get("/user/duplicates", api.ListDuplicate)
+		r.With(can(enum.PermissionUserMerge)).Get("/user/merge", api.ListMerge)
+		r.With(can(enum.PermissionUserMerge)).Post("/user/merge", api.MergeUser)
+		r.With(can(enum.PermissionUserMerge)).Post("/user/merge/{id}/revert", api.RevertMerge)
+		r.With(can(enum.PermissionUserRead)).Get("/user/{id}", api.GetUser)
+		r.With(can(enum.PermissionUserWrite)).Post("/user", api.CreateUser)
+		r.With(can(enum.PermissionUserWrite)).Put("/user", api.UpdateUser)
+		r.With(can(enum.PermissionUserWrite)).Patch("/user/{id}", api.PatchUser)
+		r.With(can(enum.PermissionUserWrite)).Post("/user/{id}/avatar", api.UploadUserAvatar)
+		r.With(can(enum.PermissionUserDelete)).Delete("/user/{id}", api.DeleteUser)
+		r.With(can(enum.PermissionUserHistory)).Get("/user/{id}/history", api.ListUserHistory)
+		r.With(can(enum.PermissionUserHistory)).Get("/user/{id}/snapshot", api.GetUserSnapshot)
+		r.With(can(enum.PermissionUserExport)).Get("/user/{id}/export", api.ExportUser)
+		r.With(can(enum.PermissionUserErase)).Post("/user/{id}/erase", api.EraseUser)
 
-		r.Get("/user", api.ListUser)
-		r.Get("/user/{id}", api.GetUser)
-		r.Post("/user", api.CreateUser)
-		r.Put("/user", api.UpdateUser)
-		r.Delete("/user/{id}", api.DeleteUser)
-
-		r.Get("/admin", api.ListAdmin)
-		r.Get("/admin/{id}", api.GetAdmin)
-		r.Post("/admin", api.GetAdmin)
-		r.Put("/admin", api.UpdateAdmin)
-		r.Delete("/admin/{id}", api.DeleteAdmin)
+		r.With(can(enum.PermissionUserRead)).Get("/attribute", api.ListAttribute)
+		r.With(can(enum.PermissionAttributeWrite)).Post("/attribute", api.CreateAttribute)
+		r.With(can(enum.PermissionAttributeWrite)).Put("/attribute/{id}", api.UpdateAttribute)
+		r.With(can(enum.PermissionAttributeWrite)).Delete("/attribute/{id}", api.DeleteAttribute)
+
+		r.With(can(enum.PermissionUserRead)).Get("/view", api.ListView)
+		r.With(can(enum.PermissionUserRead)).Get("/view/{id}", api.GetView)
+		r.With(can(enum.PermissionUserRead)).Post("/view", api.CreateView)
+		r.With(can(enum.PermissionUserRead)).Put("/view/{id}", api.UpdateView)
+		r.With(can(enum.PermissionUserRead)).Delete("/view/{id}", api.DeleteView)
+
+		r.With(can(enum.PermissionUserRead)).Get("/group", api.ListGroup)
+		r.With(can(enum.PermissionUserRead)).Get("/group/{id}", api.GetGroup)
+		r.With(can(enum.PermissionGroupWrite)).Post("/group", api.CreateGroup)
+		r.With(can(enum.PermissionGroupWrite)).Put("/group/{id}", api.UpdateGroup)
+		r.With(can(enum.PermissionGroupWrite)).Delete("/group/{id}", api.DeleteGroup)
+		r.With(can(enum.PermissionGroupWrite)).Post("/group/{id}/member", api.AddGroupMember)
+		r.With(can(enum.PermissionGroupWrite)).Delete("/group/{id}/member/{userId}", api.RemoveGroupMember)
+		r.With(can(enum.PermissionGroupWrite)).Post("/group/{id}/action", api.GroupAction)
+
+		r.With(can(enum.PermissionAdminRead)).Get("/admin", api.ListAdmin)
+		r.With(can(enum.PermissionAdminRead)).Get("/admin/{id}", api.GetAdmin)
+		r.With(can(enum.PermissionRoleRead)).Get("/admin/{id}/permissions", api.GetAdminPermissions)
+		r.With(can(enum.PermissionAdminWrite)).Post("/admin", api.CreateAdmin)
+		r.With(can(enum.PermissionAdminWrite)).Put("/admin", api.UpdateAdmin)
+		r.With(can(enum.PermissionAdminWrite)).Put("/admin/{id}/roles", api.UpdateAdminRoles)
+		r.With(can(enum.PermissionAdminWrite)).Put("/admin/{id}/scope", api.UpdateAdminScope)
+		r.With(can(enum.PermissionAdminWrite)).Delete("/admin/{id}", api.DeleteAdmin)
+		r.With(can(enum.PermissionAdminRead)).Get("/admin/invite", api.ListInvitation)
+		r.With(can(enum.PermissionAdminWrite)).Post("/admin/invite", api.InviteAdmin)
+		r.With(can(enum.PermissionAdminWrite)).Post("/admin/invite/{id}/resend", api.ResendInvitation)
+		r.With(can(enum.PermissionAdminWrite)).Delete("/admin/invite/{id}", api.RevokeInvitation)
+		r.With(can(enum.PermissionAdminWrite)).Post("/admin/{id}/grants", api.CreateGrant)
+		r.With(can(enum.PermissionAdminRead)).Get("/grants", api.ListGrant)
+		r.With(can(enum.PermissionAdminWrite)).Delete("/grants/{id}", api.RevokeGrant)
+
+		r.With(can(enum.PermissionAdminRead)).Get("/approval", api.ListApproval)
+		r.With(can(enum.PermissionAdminRead)).Get("/approval/{id}", api.GetApproval)
+		r.Post("/approval/{id}/approve", api.ApproveApproval)
+		r.Post("/approval/{id}/reject", api.RejectApproval)
+
+		r.With(can(enum.PermissionAdminRead)).Get("/review", api.ListReview)
+		r.With(can(enum.PermissionAdminRead)).Get("/review/{id}", api.GetReview)
+		r.With(can(enum.PermissionAdminRead)).Get("/review/{id}/export", api.ExportReview)
+		r.With(can(enum.PermissionReviewWrite)).Post("/review", api.CreateReview)
+		r.With(can(enum.PermissionReviewWrite)).Post("/review/{id}/close", api.CloseReview)
+		r.With(can(enum.PermissionReviewWrite)).Put("/review/{id}/items/{adminId}/reviewer", api.AssignReviewer)
+		r.With(can(enum.PermissionAdminRead)).Post("/review/{id}/items/{adminId}/decision", api.DecideReview)
+
+		r.With(can(enum.PermissionRoleRead)).Get("/permissions", api.ListPermission)
+		r.With(can(enum.PermissionRoleRead)).Get("/roles", api.ListRole)
+		r.With(can(enum.PermissionRoleRead)).Get("/roles/{key}", api.GetRole)
+		r.With(can(enum.PermissionRoleWrite)).Post("/roles", api.CreateRole)
+		r.With(can(enum.PermissionRoleWrite)).Put("/roles/{key}", api.UpdateRole)
+		r.With(can(enum.PermissionRoleWrite)).Delete("/roles/{key}", api.DeleteRole)
 	})
 }
 
@@ -89,20 +186,23 @@ func startServer(r *chi.Mux) {
 	go func() {
 		<-sig
 
-		mongodb.Disconnect()
 		shutdownCtx, shutdownCtxCancel := context.WithTimeout(serverCtx, 30*time.Second)
+		defer shutdownCtxCancel()
 		go func() {
 			<-shutdownCtx.Done()
 			if shutdownCtx.Err() == context.DeadlineExceeded {
 				log.Fatal("graceful shutdown timed out.. forcing exit.")
 			}
 		}()
-		shutdownCtxCancel()
 
 		err := server.Shutdown(shutdownCtx)
 		if err != nil {
 			log.Fatal(err)
 		}
+		// Requests are done, write what they left for the audit log before
+		// the database goes away.
+		services.StopAuditWriter(shutdownCtx)
+		mongodb.Disconnect()
 		serverStopCtx()
 	}()
 
@@ -112,3 +212,86 @@ func startServer(r *chi.Mux) {
 	}
 	<-serverCtx.Done()
 }
+
+// duplicateScanInterval reads DUPLICATE_SCAN_INTERVAL as a duration such as
+// "24h", the default.
+func duplicateScanInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("DUPLICATE_SCAN_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return 24 * time.Hour
+	}
+	return interval
+}
+
+// accessReviewInterval reads ACCESS_REVIEW_INTERVAL as a duration such as
+// "2160h", quarterly by default.
+func accessReviewInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("ACCESS_REVIEW_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return 90 * 24 * time.Hour
+	}
+	return interval
+}
+
+// accessReviewDuration reads ACCESS_REVIEW_DURATION, how long reviewers have
+// before a campaign closes, as a duration such as "336h", the default.
+func accessReviewDuration() time.Duration {
+	duration, err := time.ParseDuration(os.Getenv("ACCESS_REVIEW_DURATION"))
+	if err != nil || duration <= 0 {
+		return 14 * 24 * time.Hour
+	}
+	return duration
+}
+
+// auditCheckpointInterval reads AUDIT_CHECKPOINT_INTERVAL as a duration such
+// as "1h", the default.
+func auditCheckpointInterval() time.Duration {
+	interval, err := time.ParseDuration(os.Getenv("AUDIT_CHECKPOINT_INTERVAL"))
+	if err != nil || interval <= 0 {
+		return time.Hour
+	}
+	return interval
+}
+
+// auditVerify walks the audit chain in the database, or the segment exported
+// to the file given, prints the report and returns the exit code: 1 when the
+// chain is broken.
+func auditVerify(args []string) int {
+	key, err := services.AuditVerifyKey()
+	if err != nil {
+		log.Println(err)
+		return 2
+	}
+	var report services.AuditReport
+	if len(args) > 0 {
+		if key == nil {
+			log.Println("AUDIT_VERIFY_KEY is required to verify an export")
+			return 2
+		}
+		file, err := os.Open(args[0])
+		if err != nil {
+			log.Println(err)
+			return 2
+		}
+		defer file.Close()
+		report, err = services.VerifyAuditExport(file, key)
+		if err != nil {
+			log.Println(err)
+			return 2
+		}
+	} else {
+		mongodb.Connect()
+		defer mongodb.Disconnect()
+		report, err = services.VerifyAudit(context.Background())
+		if err != nil {
+			log.Println(err)
+			return 2
+		}
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if report.Break != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Audit records every mutating request in the audit log once handled, panics
+// included. It must run after middleware.RequestID and middleware.RealIP.
+func Audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := services.StartAudit(r.Context(), models.AuditEntry{
+			RequestID: middleware.GetReqID(r.Context()),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			IP:        r.RemoteAddr,
+			UserAgent: r.UserAgent(),
+		})
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			p := recover()
+			if p != nil {
+				status = http.StatusInternalServerError
+			}
+			pattern := r.URL.Path
+			target := models.AuditTarget{}
+			if rctx := chi.RouteContext(ctx); rctx != nil {
+				if rctx.RoutePattern() != "" {
+					pattern = rctx.RoutePattern()
+				}
+				target.Collection, _, _ = strings.Cut(strings.TrimPrefix(pattern, "/"), "/")
+				target.ID = rctx.URLParam("id")
+				if target.ID == "" {
+					target.ID = rctx.URLParam("key")
+				}
+			}
+			services.FinishAudit(ctx, r.Method+" "+pattern, target, status)
+			if p != nil {
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
@@ -1,11 +1,10 @@
 package middlewares
 
 import (
-	"context"
 	"net/http"
 	"strings"
 
-	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/services"
 	"github.com/anyshare/anyshare-common/mongodb"
 	"github.com/anyshare/anyshare-common/schemas"
 	"go.mongodb.org/mongo-driver/bson"
@@ -34,7 +33,13 @@ func Authentication(next http.Handler) http.Handler {
 			w.WriteHeader(401)
 			return
 		}
-		ctx := context.WithValue(r.Context(), enum.ContextKeyUser, user)
+		services.SetAuditActor(r.Context(), user.ID)
+		ctx, err := services.WithIdentity(r.Context(), user)
+		if err != nil {
+			w.WriteHeader(500)
+			w.Write([]byte(err.Error()))
+			return
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,21 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+)
+
+// RequirePermission answers 403 unless the admin holds permission, it must
+// run after Authentication.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !helpers.HasPermission(r.Context(), permission) {
+				w.WriteHeader(403)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
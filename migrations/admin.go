@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// IndexActiveAdmins makes a user an active admin at most once. Active admins
+// have no deleteTime, which a partial index cannot select on, so the index
+// covers userId with deleteTime instead: revoked records differ by the time
+// they were revoked. Duplicates already there are logged and must be revoked
+// before it can be created.
+func IndexActiveAdmins(ctx context.Context) error {
+	_, err := models.Collection(models.AdminCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "deleteTime", Value: 1}},
+		Options: options.Index().SetName("user_active_unique").SetUnique(true),
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		log.Println("users with several active admin records must be resolved before the unique admin index can be created:", err)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,88 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/services"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// EmailCollision groups users whose emails share the same canonical form.
+type EmailCollision struct {
+	Email   string
+	UserIDs []primitive.ObjectID
+	Emails  []string
+}
+
+// NormalizeEmails rewrites stored emails to their canonical form. Colliding
+// accounts are left untouched and returned for manual resolution, the unique
+// email index is only created once none remain.
+func NormalizeEmails(ctx context.Context) ([]EmailCollision, error) {
+	db := mongodb.GetCollection(schemas.User{})
+	cursor, err := db.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"email": 1, "fullName": 1, "address": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	groups := map[string]*EmailCollision{}
+	users := map[primitive.ObjectID]schemas.User{}
+	order := []string{}
+	for cursor.Next(ctx) {
+		user := schemas.User{}
+		if err := cursor.Decode(&user); err != nil {
+			return nil, err
+		}
+		email := helpers.NormalizeEmail(user.Email)
+		group, ok := groups[email]
+		if !ok {
+			group = &EmailCollision{Email: email}
+			groups[email] = group
+			order = append(order, email)
+		}
+		users[user.ID] = user
+		group.UserIDs = append(group.UserIDs, user.ID)
+		group.Emails = append(group.Emails, user.Email)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	collisions := []EmailCollision{}
+	models := []mongo.WriteModel{}
+	for _, email := range order {
+		group := groups[email]
+		if len(group.UserIDs) > 1 {
+			collisions = append(collisions, *group)
+			continue
+		}
+		if group.Emails[0] != email {
+			user := users[group.UserIDs[0]]
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": user.ID}).
+				SetUpdate(bson.M{"$set": bson.M{
+					"email":  email,
+					"search": services.UserSearchFields(email, user.FullName, user.Address),
+				}}))
+		}
+	}
+	if len(models) > 0 {
+		if _, err := db.BulkWrite(ctx, models); err != nil {
+			return nil, err
+		}
+	}
+	if len(collisions) > 0 {
+		return collisions, nil
+	}
+	_, err = db.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true),
+	})
+	return nil, err
+}
@@ -0,0 +1,28 @@
+package migrations
+
+import (
+	"context"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StripMergePasswords removes the password hashes kept in merge snapshots,
+// keeping only the one of the target when the merge replaced it, which is
+// what reverting the merge needs.
+func StripMergePasswords(ctx context.Context) error {
+	_, err := models.Collection(models.MergeCollection).UpdateMany(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"source.password": bson.M{"$exists": true}},
+			bson.M{"target.password": bson.M{"$exists": true}},
+		},
+	}, bson.A{
+		bson.M{"$set": bson.M{"replacedPassword": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$fields.password", "source"}},
+			"$target.password",
+			"$$REMOVE",
+		}}}},
+		bson.M{"$unset": bson.A{"source.password", "target.password"}},
+	})
+	return err
+}
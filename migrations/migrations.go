@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"context"
+	"log"
+)
+
+// Run applies every migration in order, stopping at the first failure.
+func Run(ctx context.Context) error {
+	collisions, err := NormalizeEmails(ctx)
+	if err != nil {
+		return err
+	}
+	for _, collision := range collisions {
+		log.Printf("email collision on %q: users %v have emails %q", collision.Email, collision.UserIDs, collision.Emails)
+	}
+	if len(collisions) > 0 {
+		log.Printf("%d email collisions must be resolved before the unique email index can be created", len(collisions))
+	}
+	err = StripMergePasswords(ctx)
+	if err != nil {
+		return err
+	}
+	return IndexActiveAdmins(ctx)
+}
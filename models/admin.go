@@ -0,0 +1,32 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Name of the shared schemas.Admin collection.
+const AdminCollection = "admins"
+
+// Admin reads an admin document, User is only set when the aggregation joined
+// it from the users collection.
+type Admin struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `bson:"userId"`
+	User       *User              `bson:"user,omitempty"`
+	Roles      []string           `bson:"roles"`
+	JoinTime   int64              `bson:"joinTime"`
+	DeleteTime int64              `bson:"deleteTime,omitempty"`
+	Version    int64              `bson:"version"`
+	Scope      *Scope             `bson:"scope,omitempty"`
+}
+
+// Scope limits an admin to a subset of users: members of one of GroupIDs
+// whose attributes take one of the listed values, for every listed
+// attribute. Parts left empty do not restrict, no scope at all means every
+// user.
+type Scope struct {
+	GroupIDs   []primitive.ObjectID     `bson:"groupIds,omitempty"`
+	Attributes map[string][]interface{} `bson:"attributes,omitempty"`
+}
+
+func (scope *Scope) IsEmpty() bool {
+	return scope == nil || (len(scope.GroupIDs) == 0 && len(scope.Attributes) == 0)
+}
@@ -0,0 +1,50 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const ApprovalCollection = "approvals"
+
+// Actions which may need a second admin's approval.
+const (
+	ApprovalAdminDelete    = "admin.delete"
+	ApprovalUserBulkDelete = "user.bulkDelete"
+	ApprovalRoleEscalation = "role.escalate"
+)
+
+var ApprovalActions = []string{ApprovalAdminDelete, ApprovalUserBulkDelete, ApprovalRoleEscalation}
+
+const (
+	ApprovalPending  = "pending"
+	ApprovalApproved = "approved"
+	ApprovalRejected = "rejected"
+	ApprovalExecuted = "executed"
+	ApprovalFailed   = "failed"
+	ApprovalExpired  = "expired"
+)
+
+// Approval is a protected request put on hold until another admin approves
+// it. Handler, Params, Body and IfMatch are what it takes to run the request
+// again once approved, Roles lists the roles it would grant and Permissions
+// what a role change would add to a role.
+type Approval struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty"`
+	Action       string             `bson:"action"`
+	Permission   string             `bson:"permission"`
+	Roles        []string           `bson:"roles,omitempty"`
+	Permissions  []string           `bson:"permissions,omitempty"`
+	TargetID     primitive.ObjectID `bson:"targetId,omitempty"`
+	Handler      string             `bson:"handler"`
+	Params       map[string]string  `bson:"params"`
+	Query        string             `bson:"query"`
+	Body         []byte             `bson:"body"`
+	IfMatch      string             `bson:"ifMatch,omitempty"`
+	Status       string             `bson:"status"`
+	RequestedBy  primitive.ObjectID `bson:"requestedBy"`
+	ReviewedBy   primitive.ObjectID `bson:"reviewedBy,omitempty"`
+	Reason       string             `bson:"reason,omitempty"`
+	ResultStatus int                `bson:"resultStatus,omitempty"`
+	CreateTime   int64              `bson:"createTime"`
+	ExpireTime   int64              `bson:"expireTime"`
+	ReviewTime   int64              `bson:"reviewTime,omitempty"`
+	ExecuteTime  int64              `bson:"executeTime,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const AttributeCollection = "attribute_definitions"
+
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+	AttributeTypeDate    = "date"
+	AttributeTypeEnum    = "enum"
+)
+
+// AttributeDefinition declares a custom attribute admins can store on users
+// under "attributes.<Key>".
+type AttributeDefinition struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Key        string             `bson:"key"`
+	Type       string             `bson:"type"`
+	Required   bool               `bson:"required"`
+	EnumValues []string           `bson:"enumValues,omitempty"`
+	Rules      string             `bson:"rules,omitempty"`
+	Labels     map[string]string  `bson:"labels,omitempty"`
+	CreateTime int64              `bson:"createTime"`
+	UpdateTime int64              `bson:"updateTime"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const AuditCollection = "audit_logs"
+
+// AuditTarget is the resource a request acted on, ID is a hex ObjectID or a
+// key such as a role key.
+type AuditTarget struct {
+	Collection string `bson:"collection,omitempty"`
+	ID         string `bson:"id,omitempty"`
+}
+
+// AuditChange is one record written by the request. It names the fields
+// changed only, their values stay in the history entry HistoryID where they
+// can be erased, audit entries cannot.
+type AuditChange struct {
+	Collection string             `bson:"collection"`
+	RecordID   primitive.ObjectID `bson:"recordId"`
+	Action     string             `bson:"action"`
+	HistoryID  primitive.ObjectID `bson:"historyId"`
+	Fields     []string           `bson:"fields"`
+}
+
+// AuditEntry records one mutating request. Action is the method and route
+// pattern, such as "DELETE /admin/{id}". ImpersonatorID is the admin acting
+// as ActorID and APIKeyID the API key the request was made with, if any.
+//
+// Entries are chained: Seq numbers them without gaps and Hash covers the
+// stored document, PrevHash included, so an entry cannot be edited or removed
+// without breaking the chain. Hash stays last so that it can be left out of
+// what it covers, see services.VerifyAudit.
+//
+// IP and UserAgent are sealed into Client with the key of the actor once
+// written, erasing the key erases them. They stay as they are for requests
+// without an actor.
+type AuditEntry struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty"`
+	RequestID      string             `bson:"requestId"`
+	Action         string             `bson:"action"`
+	Method         string             `bson:"method"`
+	Path           string             `bson:"path"`
+	ActorID        primitive.ObjectID `bson:"actorId,omitempty"`
+	ImpersonatorID primitive.ObjectID `bson:"impersonatorId,omitempty"`
+	APIKeyID       string             `bson:"apiKeyId,omitempty"`
+	Target         AuditTarget        `bson:"target"`
+	Changes        []AuditChange      `bson:"changes,omitempty"`
+	Status         int                `bson:"status"`
+	IP             string             `bson:"ip,omitempty"`
+	UserAgent      string             `bson:"userAgent,omitempty"`
+	Client         []byte             `bson:"client,omitempty"`
+	CreateTime     int64              `bson:"createTime"`
+	Duration       int64              `bson:"duration"`
+	Seq            int64              `bson:"seq"`
+	PrevHash       string             `bson:"prevHash"`
+	Hash           string             `bson:"hash,omitempty"`
+}
+
+const AuditKeyCollection = "audit_keys"
+
+// AuditKey is the key the client details of the audit entries of a user are
+// sealed with, by user id.
+type AuditKey struct {
+	UserID     primitive.ObjectID `bson:"_id"`
+	Key        []byte             `bson:"key"`
+	CreateTime int64              `bson:"createTime"`
+}
+
+const AuditCheckpointCollection = "audit_checkpoints"
+
+// AuditCheckpoint is the head of the audit chain at some point, signed with
+// the server key so that an exported segment ending at it can be verified
+// offline. KeyID tells which key signed it.
+type AuditCheckpoint struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Seq        int64              `bson:"seq"`
+	Hash       string             `bson:"hash"`
+	CreateTime int64              `bson:"createTime"`
+	KeyID      string             `bson:"keyId"`
+	Signature  []byte             `bson:"signature"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Avatar describes the stored variants of a user's profile picture.
+type Avatar struct {
+	Hash       string `bson:"hash"`
+	Sizes      []int  `bson:"sizes"`
+	UpdateTime int64  `bson:"updateTime"`
+}
+
+// AvatarKey is the storage key of one avatar variant. Keys embed the upload
+// hash, so the stored objects never change and can be cached indefinitely.
+func AvatarKey(userID primitive.ObjectID, hash string, size int) string {
+	return fmt.Sprintf("avatars/%s/%s/%d", userID.Hex(), hash, size)
+}
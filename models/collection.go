@@ -0,0 +1,13 @@
+package models
+
+import (
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Collection returns a collection owned by this API, which lives in the same
+// database as the shared schemas.
+func Collection(name string) *mongo.Collection {
+	return mongodb.GetCollection(schemas.User{}).Database().Collection(name)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const DuplicateCollection = "duplicate_candidates"
+
+const (
+	DuplicateReasonEmail   = "email"
+	DuplicateReasonName    = "name"
+	DuplicateReasonAddress = "address"
+)
+
+// DuplicateCandidate is a pair of users that likely are the same person.
+type DuplicateCandidate struct {
+	ID         primitive.ObjectID   `bson:"_id,omitempty"`
+	UserIDs    []primitive.ObjectID `bson:"userIds"`
+	Reasons    []string             `bson:"reasons"`
+	Score      float64              `bson:"score"`
+	DetectTime int64                `bson:"detectTime"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const GrantCollection = "role_grants"
+
+const (
+	GrantScheduled = "scheduled"
+	GrantActive    = "active"
+	GrantExpired   = "expired"
+	GrantRevoked   = "revoked"
+)
+
+// Grant gives an admin a role from StartTime until EndTime only, on top of
+// their permanent roles. It is honored while it is neither expired nor
+// revoked, nothing needs to run when it ends.
+type Grant struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	AdminID       primitive.ObjectID `bson:"adminId"`
+	Role          string             `bson:"role"`
+	Justification string             `bson:"justification"`
+	GrantedBy     primitive.ObjectID `bson:"grantedBy"`
+	StartTime     int64              `bson:"startTime"`
+	EndTime       int64              `bson:"endTime"`
+	CreateTime    int64              `bson:"createTime"`
+	RevokeTime    int64              `bson:"revokeTime,omitempty"`
+	RevokedBy     primitive.ObjectID `bson:"revokedBy,omitempty"`
+}
+
+// Status tells where the grant stands at the given unix time.
+func (grant Grant) Status(now int64) string {
+	switch {
+	case grant.RevokeTime > 0:
+		return GrantRevoked
+	case grant.EndTime <= now:
+		return GrantExpired
+	case grant.StartTime > now:
+		return GrantScheduled
+	}
+	return GrantActive
+}
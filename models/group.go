@@ -0,0 +1,14 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const GroupCollection = "groups"
+
+// Group organizes users, members list it in their GroupIDs.
+type Group struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Name       string             `bson:"name"`
+	Desc       string             `bson:"desc"`
+	CreateTime int64              `bson:"createTime"`
+	UpdateTime int64              `bson:"updateTime"`
+}
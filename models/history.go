@@ -0,0 +1,29 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const HistoryCollection = "histories"
+
+// Value recorded in place of secret fields such as passwords.
+const RedactedValue = "[redacted]"
+
+type FieldChange struct {
+	Field  string      `bson:"field"`
+	Before interface{} `bson:"before"`
+	After  interface{} `bson:"after"`
+}
+
+// History is one mutation of a record, listing the fields it changed.
+// ApproverID and ApprovalID are set when the mutation ran once another admin
+// approved it.
+type History struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Collection string             `bson:"collection"`
+	RecordID   primitive.ObjectID `bson:"recordId"`
+	ActorID    primitive.ObjectID `bson:"actorId"`
+	ApproverID primitive.ObjectID `bson:"approverId,omitempty"`
+	ApprovalID primitive.ObjectID `bson:"approvalId,omitempty"`
+	Action     string             `bson:"action"`
+	Changes    []FieldChange      `bson:"changes"`
+	CreateTime int64              `bson:"createTime"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const InvitationCollection = "invitations"
+
+// Invitation offers admin roles to an email. Only the SHA-256 hash of the
+// token sent by email is stored, resending replaces it.
+type Invitation struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Email      string             `bson:"email"`
+	Roles      []string           `bson:"roles"`
+	Locale     string             `bson:"locale"`
+	TokenHash  string             `bson:"tokenHash"`
+	InvitedBy  primitive.ObjectID `bson:"invitedBy"`
+	SendCount  int                `bson:"sendCount"`
+	CreateTime int64              `bson:"createTime"`
+	SendTime   int64              `bson:"sendTime"`
+	ExpireTime int64              `bson:"expireTime"`
+	AcceptTime int64              `bson:"acceptTime,omitempty"`
+	RevokeTime int64              `bson:"revokeTime,omitempty"`
+	UserID     primitive.ObjectID `bson:"userId,omitempty"`
+}
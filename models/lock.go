@@ -0,0 +1,12 @@
+package models
+
+const LockCollection = "locks"
+
+// Lock is a document transactions write to on purpose so that concurrent
+// ones touching the same invariant conflict, see services.GuardAdmins. The
+// audit lock also holds the head of the audit chain in Seq and Hash.
+type Lock struct {
+	ID   string `bson:"_id"`
+	Seq  int64  `bson:"seq"`
+	Hash string `bson:"hash,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const MergeCollection = "merges"
+
+// Merge records the merge of Source into Target with the documents as they
+// were before, so that it can be reverted as long as neither user changed
+// since. SourceVersion and TargetVersion are the versions the merge left.
+// The snapshots leave out password hashes, ReplacedPassword keeps the one of
+// the target when the merge gave it the password of the source.
+type Merge struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	SourceID         primitive.ObjectID `bson:"sourceId"`
+	TargetID         primitive.ObjectID `bson:"targetId"`
+	ActorID          primitive.ObjectID `bson:"actorId"`
+	Fields           map[string]string  `bson:"fields"`
+	Source           bson.M             `bson:"source"`
+	Target           bson.M             `bson:"target"`
+	Admins           []bson.M           `bson:"admins"`
+	TokenIDs         []string           `bson:"tokenIds"`
+	ReplacedPassword string             `bson:"replacedPassword,omitempty"`
+	SourceVersion    int64              `bson:"sourceVersion"`
+	TargetVersion    int64              `bson:"targetVersion"`
+	CreateTime       int64              `bson:"createTime"`
+	RevertTime       int64              `bson:"revertTime,omitempty"`
+	RevertedBy       primitive.ObjectID `bson:"revertedBy,omitempty"`
+}
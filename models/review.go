@@ -0,0 +1,47 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const ReviewCollection = "access_reviews"
+
+const (
+	ReviewOpen   = "open"
+	ReviewClosed = "closed"
+)
+
+const (
+	ReviewKeep   = "keep"
+	ReviewRevoke = "revoke"
+)
+
+// Review is an access review campaign. Items snapshot every active admin and
+// their roles when it starts, each with the reviewer asked to decide whether
+// they keep their access.
+type Review struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty"`
+	Name       string             `bson:"name"`
+	Status     string             `bson:"status"`
+	Items      []ReviewItem       `bson:"items"`
+	CreatedBy  primitive.ObjectID `bson:"createdBy,omitempty"`
+	CreateTime int64              `bson:"createTime"`
+	DueTime    int64              `bson:"dueTime"`
+	ClosedBy   primitive.ObjectID `bson:"closedBy,omitempty"`
+	CloseTime  int64              `bson:"closeTime,omitempty"`
+}
+
+// ReviewItem is the decision on one admin. ApplyTime and ApplyError tell how
+// a revoke decision went when the campaign closed.
+type ReviewItem struct {
+	AdminID    primitive.ObjectID `bson:"adminId"`
+	UserID     primitive.ObjectID `bson:"userId"`
+	Email      string             `bson:"email"`
+	FullName   string             `bson:"fullName"`
+	Roles      []string           `bson:"roles"`
+	ReviewerID primitive.ObjectID `bson:"reviewerId,omitempty"`
+	Decision   string             `bson:"decision,omitempty"`
+	Comment    string             `bson:"comment,omitempty"`
+	DecidedBy  primitive.ObjectID `bson:"decidedBy,omitempty"`
+	DecideTime int64              `bson:"decideTime,omitempty"`
+	ApplyTime  int64              `bson:"applyTime,omitempty"`
+	ApplyError string             `bson:"applyError,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const RoleCollection = "roles"
+
+// Permission granting every permission of the catalog.
+const AllPermissions = "*"
+
+// Role is a named set of permissions, along with those of the roles it
+// inherits. Built-in roles live in code and cannot be changed.
+type Role struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty"`
+	Key         string             `bson:"key"`
+	Name        string             `bson:"name"`
+	Desc        string             `bson:"desc"`
+	Permissions []string           `bson:"permissions"`
+	Inherits    []string           `bson:"inherits"`
+	BuiltIn     bool               `bson:"-"`
+	CreateTime  int64              `bson:"createTime"`
+	UpdateTime  int64              `bson:"updateTime"`
+}
+
+var BuiltInRoles = []Role{
+	{
+		Key:         enum.RoleSuperAdmin,
+		Name:        "Super admin",
+		Desc:        "Every permission",
+		Permissions: []string{AllPermissions},
+		BuiltIn:     true,
+	},
+	{
+		Key:  enum.RoleAdmin,
+		Name: "Admin",
+		Desc: "Manages users and admins, except roles and erasure",
+		Permissions: []string{
+			enum.PermissionUserWrite, enum.PermissionUserDelete, enum.PermissionUserEmail,
+			enum.PermissionUserExport, enum.PermissionUserMerge, enum.PermissionAdminWrite,
+			enum.PermissionAttributeWrite, enum.PermissionGroupWrite,
+		},
+		Inherits: []string{enum.RoleViewer},
+		BuiltIn:  true,
+	},
+	{
+		Key:  enum.RoleViewer,
+		Name: "Viewer",
+		Desc: "Reads users, admins and statistics",
+		Permissions: []string{
+			enum.PermissionUserRead, enum.PermissionUserHistory, enum.PermissionAdminRead,
+			enum.PermissionRoleRead, enum.PermissionStatsRead,
+		},
+		BuiltIn: true,
+	},
+}
+
+func BuiltInRole(key string) (Role, bool) {
+	for _, role := range BuiltInRoles {
+		if role.Key == key {
+			return role, true
+		}
+	}
+	return Role{}, false
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Name of the shared schemas.User collection.
+const UserCollection = "users"
+
+// User reads a user document along with the fields this API stores next to
+// the shared schema. Version is bumped by every write through
+// helpers.UpdateVersion. Attributes holds the values of the custom
+// attributes declared by AttributeDefinition.
+type User struct {
+	schemas.User  `bson:",inline"`
+	Version       int64                `bson:"version"`
+	Avatar        *Avatar              `bson:"avatar,omitempty"`
+	Attributes    bson.M               `bson:"attributes,omitempty"`
+	GroupIDs      []primitive.ObjectID `bson:"groupIds,omitempty"`
+	Tags          []string             `bson:"tags,omitempty"`
+	EraseTime     int64                `bson:"eraseTime,omitempty"`
+	LastLoginTime int64                `bson:"lastLoginTime,omitempty"`
+}
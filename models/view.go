@@ -0,0 +1,18 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const ViewCollection = "views"
+
+// View is a ListUser query saved by an admin, Query holds the query
+// parameters it applies. Admins with one of SharedRoles can use it too.
+type View struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty"`
+	OwnerID     primitive.ObjectID  `bson:"ownerId"`
+	Name        string              `bson:"name"`
+	Query       map[string][]string `bson:"query"`
+	Columns     []string            `bson:"columns"`
+	SharedRoles []string            `bson:"sharedRoles"`
+	CreateTime  int64               `bson:"createTime"`
+	UpdateTime  int64               `bson:"updateTime"`
+}
@@ -0,0 +1,60 @@
+package responses
+
+import (
+	"context"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Admin struct {
+	ID         primitive.ObjectID `json:"id"`
+	UserID     primitive.ObjectID `json:"userId"`
+	User       *User              `json:"user,omitempty"`
+	Roles      []string           `json:"roles"`
+	JoinTime   int64              `json:"joinTime"`
+	DeleteTime int64              `json:"deleteTime,omitempty"`
+	Version    int64              `json:"version"`
+	Scope      *Scope             `json:"scope,omitempty"`
+}
+
+type Scope struct {
+	GroupIDs   []primitive.ObjectID     `json:"groupIds"`
+	Attributes map[string][]interface{} `json:"attributes"`
+}
+
+func NewAdmin(ctx context.Context, admin models.Admin) Admin {
+	item := Admin{
+		ID:         admin.ID,
+		UserID:     admin.UserID,
+		Roles:      admin.Roles,
+		JoinTime:   admin.JoinTime,
+		DeleteTime: admin.DeleteTime,
+		Version:    admin.Version,
+	}
+	if item.Roles == nil {
+		item.Roles = []string{}
+	}
+	if !admin.Scope.IsEmpty() {
+		item.Scope = &Scope{GroupIDs: admin.Scope.GroupIDs, Attributes: admin.Scope.Attributes}
+		if item.Scope.GroupIDs == nil {
+			item.Scope.GroupIDs = []primitive.ObjectID{}
+		}
+		if item.Scope.Attributes == nil {
+			item.Scope.Attributes = map[string][]interface{}{}
+		}
+	}
+	if admin.User != nil {
+		user := NewUser(ctx, *admin.User)
+		item.User = &user
+	}
+	return item
+}
+
+func NewAdmins(ctx context.Context, admins []models.Admin) []Admin {
+	items := make([]Admin, 0, len(admins))
+	for _, admin := range admins {
+		items = append(items, NewAdmin(ctx, admin))
+	}
+	return items
+}
@@ -0,0 +1,74 @@
+package responses
+
+import (
+	"encoding/json"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Approval shows the request on hold as it will run, so that reviewers know
+// what they approve.
+type Approval struct {
+	ID           primitive.ObjectID  `json:"id"`
+	Action       string              `json:"action"`
+	Permission   string              `json:"permission"`
+	Roles        []string            `json:"roles,omitempty"`
+	Permissions  []string            `json:"permissions,omitempty"`
+	TargetID     *primitive.ObjectID `json:"targetId,omitempty"`
+	Params       map[string]string   `json:"params"`
+	Query        string              `json:"query,omitempty"`
+	Body         json.RawMessage     `json:"body,omitempty"`
+	Status       string              `json:"status"`
+	RequestedBy  primitive.ObjectID  `json:"requestedBy"`
+	ReviewedBy   *primitive.ObjectID `json:"reviewedBy,omitempty"`
+	Reason       string              `json:"reason,omitempty"`
+	ResultStatus int                 `json:"resultStatus,omitempty"`
+	CreateTime   int64               `json:"createTime"`
+	ExpireTime   int64               `json:"expireTime"`
+	ReviewTime   int64               `json:"reviewTime,omitempty"`
+	ExecuteTime  int64               `json:"executeTime,omitempty"`
+}
+
+func NewApproval(approval models.Approval, now int64) Approval {
+	res := Approval{
+		ID:           approval.ID,
+		Action:       approval.Action,
+		Permission:   approval.Permission,
+		Roles:        approval.Roles,
+		Permissions:  approval.Permissions,
+		Params:       approval.Params,
+		Query:        approval.Query,
+		Status:       approval.Status,
+		RequestedBy:  approval.RequestedBy,
+		Reason:       approval.Reason,
+		ResultStatus: approval.ResultStatus,
+		CreateTime:   approval.CreateTime,
+		ExpireTime:   approval.ExpireTime,
+		ReviewTime:   approval.ReviewTime,
+		ExecuteTime:  approval.ExecuteTime,
+	}
+	if res.Status == models.ApprovalPending && approval.ExpireTime <= now {
+		res.Status = models.ApprovalExpired
+	}
+	if json.Valid(approval.Body) {
+		res.Body = approval.Body
+	}
+	if !approval.TargetID.IsZero() {
+		targetID := approval.TargetID
+		res.TargetID = &targetID
+	}
+	if !approval.ReviewedBy.IsZero() {
+		reviewedBy := approval.ReviewedBy
+		res.ReviewedBy = &reviewedBy
+	}
+	return res
+}
+
+func NewApprovals(approvals []models.Approval, now int64) []Approval {
+	items := make([]Approval, 0, len(approvals))
+	for _, approval := range approvals {
+		items = append(items, NewApproval(approval, now))
+	}
+	return items
+}
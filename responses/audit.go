@@ -0,0 +1,65 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type AuditTarget struct {
+	Collection string `json:"collection,omitempty"`
+	ID         string `json:"id,omitempty"`
+}
+
+type AuditChange struct {
+	Collection string             `json:"collection"`
+	RecordID   primitive.ObjectID `json:"recordId"`
+	Action     string             `json:"action"`
+	HistoryID  primitive.ObjectID `json:"historyId"`
+	Fields     []string           `json:"fields"`
+}
+
+type AuditEntry struct {
+	ID             primitive.ObjectID  `json:"id"`
+	RequestID      string              `json:"requestId"`
+	Action         string              `json:"action"`
+	Method         string              `json:"method"`
+	Path           string              `json:"path"`
+	ActorID        *primitive.ObjectID `json:"actorId,omitempty"`
+	ImpersonatorID *primitive.ObjectID `json:"impersonatorId,omitempty"`
+	APIKeyID       string              `json:"apiKeyId,omitempty"`
+	Target         AuditTarget         `json:"target"`
+	Changes        []AuditChange       `json:"changes"`
+	Status         int                 `json:"status"`
+	IP             string              `json:"ip"`
+	UserAgent      string              `json:"userAgent"`
+	CreateTime     int64               `json:"createTime"`
+	Duration       int64               `json:"duration"`
+}
+
+func NewAuditEntries(entries []models.AuditEntry) []AuditEntry {
+	items := make([]AuditEntry, 0, len(entries))
+	for _, entry := range entries {
+		changes := make([]AuditChange, 0, len(entry.Changes))
+		for _, change := range entry.Changes {
+			changes = append(changes, AuditChange(change))
+		}
+		items = append(items, AuditEntry{
+			ID:             entry.ID,
+			RequestID:      entry.RequestID,
+			Action:         entry.Action,
+			Method:         entry.Method,
+			Path:           entry.Path,
+			ActorID:        optionalID(entry.ActorID),
+			ImpersonatorID: optionalID(entry.ImpersonatorID),
+			APIKeyID:       entry.APIKeyID,
+			Target:         AuditTarget(entry.Target),
+			Changes:        changes,
+			Status:         entry.Status,
+			IP:             entry.IP,
+			UserAgent:      entry.UserAgent,
+			CreateTime:     entry.CreateTime,
+			Duration:       entry.Duration,
+		})
+	}
+	return items
+}
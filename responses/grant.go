@@ -0,0 +1,48 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Grant struct {
+	ID            primitive.ObjectID  `json:"id"`
+	AdminID       primitive.ObjectID  `json:"adminId"`
+	Role          string              `json:"role"`
+	Justification string              `json:"justification"`
+	Status        string              `json:"status"`
+	GrantedBy     primitive.ObjectID  `json:"grantedBy"`
+	StartTime     int64               `json:"startTime"`
+	EndTime       int64               `json:"endTime"`
+	CreateTime    int64               `json:"createTime"`
+	RevokeTime    int64               `json:"revokeTime,omitempty"`
+	RevokedBy     *primitive.ObjectID `json:"revokedBy,omitempty"`
+}
+
+func NewGrant(grant models.Grant, now int64) Grant {
+	res := Grant{
+		ID:            grant.ID,
+		AdminID:       grant.AdminID,
+		Role:          grant.Role,
+		Justification: grant.Justification,
+		Status:        grant.Status(now),
+		GrantedBy:     grant.GrantedBy,
+		StartTime:     grant.StartTime,
+		EndTime:       grant.EndTime,
+		CreateTime:    grant.CreateTime,
+		RevokeTime:    grant.RevokeTime,
+	}
+	if !grant.RevokedBy.IsZero() {
+		revokedBy := grant.RevokedBy
+		res.RevokedBy = &revokedBy
+	}
+	return res
+}
+
+func NewGrants(grants []models.Grant, now int64) []Grant {
+	items := make([]Grant, 0, len(grants))
+	for _, grant := range grants {
+		items = append(items, NewGrant(grant, now))
+	}
+	return items
+}
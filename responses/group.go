@@ -0,0 +1,26 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Group struct {
+	ID          primitive.ObjectID `json:"id"`
+	Name        string             `json:"name"`
+	Desc        string             `json:"desc"`
+	MemberCount int64              `json:"memberCount"`
+	CreateTime  int64              `json:"createTime"`
+	UpdateTime  int64              `json:"updateTime"`
+}
+
+func NewGroup(group models.Group, memberCount int64) Group {
+	return Group{
+		ID:          group.ID,
+		Name:        group.Name,
+		Desc:        group.Desc,
+		MemberCount: memberCount,
+		CreateTime:  group.CreateTime,
+		UpdateTime:  group.UpdateTime,
+	}
+}
@@ -0,0 +1,48 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type History struct {
+	ID         primitive.ObjectID  `json:"id"`
+	RecordID   primitive.ObjectID  `json:"recordId"`
+	ActorID    primitive.ObjectID  `json:"actorId"`
+	ApproverID *primitive.ObjectID `json:"approverId,omitempty"`
+	ApprovalID *primitive.ObjectID `json:"approvalId,omitempty"`
+	Action     string              `json:"action"`
+	Changes    []FieldChange       `json:"changes"`
+	CreateTime int64               `json:"createTime"`
+}
+
+func NewHistories(entries []models.History) []History {
+	items := make([]History, 0, len(entries))
+	for _, entry := range entries {
+		changes := make([]FieldChange, 0, len(entry.Changes))
+		for _, change := range entry.Changes {
+			changes = append(changes, FieldChange(change))
+		}
+		item := History{
+			ID:         entry.ID,
+			RecordID:   entry.RecordID,
+			ActorID:    entry.ActorID,
+			Action:     entry.Action,
+			Changes:    changes,
+			CreateTime: entry.CreateTime,
+		}
+		if !entry.ApprovalID.IsZero() {
+			approverID, approvalID := entry.ApproverID, entry.ApprovalID
+			item.ApproverID = &approverID
+			item.ApprovalID = &approvalID
+		}
+		items = append(items, item)
+	}
+	return items
+}
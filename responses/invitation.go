@@ -0,0 +1,63 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// Invitation never carries the token, it only ever leaves by email.
+type Invitation struct {
+	ID         primitive.ObjectID `json:"id"`
+	Email      string             `json:"email"`
+	Roles      []string           `json:"roles"`
+	Locale     string             `json:"locale"`
+	Status     string             `json:"status"`
+	InvitedBy  primitive.ObjectID `json:"invitedBy"`
+	SendCount  int                `json:"sendCount"`
+	CreateTime int64              `json:"createTime"`
+	SendTime   int64              `json:"sendTime"`
+	ExpireTime int64              `json:"expireTime"`
+	AcceptTime int64              `json:"acceptTime,omitempty"`
+	RevokeTime int64              `json:"revokeTime,omitempty"`
+}
+
+func NewInvitation(invitation models.Invitation, now int64) Invitation {
+	status := InvitationPending
+	switch {
+	case invitation.AcceptTime > 0:
+		status = InvitationAccepted
+	case invitation.RevokeTime > 0:
+		status = InvitationRevoked
+	case invitation.ExpireTime <= now:
+		status = InvitationExpired
+	}
+	return Invitation{
+		ID:         invitation.ID,
+		Email:      invitation.Email,
+		Roles:      invitation.Roles,
+		Locale:     invitation.Locale,
+		Status:     status,
+		InvitedBy:  invitation.InvitedBy,
+		SendCount:  invitation.SendCount,
+		CreateTime: invitation.CreateTime,
+		SendTime:   invitation.SendTime,
+		ExpireTime: invitation.ExpireTime,
+		AcceptTime: invitation.AcceptTime,
+		RevokeTime: invitation.RevokeTime,
+	}
+}
+
+func NewInvitations(invitations []models.Invitation, now int64) []Invitation {
+	items := make([]Invitation, 0, len(invitations))
+	for _, invitation := range invitations {
+		items = append(items, NewInvitation(invitation, now))
+	}
+	return items
+}
@@ -0,0 +1,50 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Merge leaves out the stored snapshots, they are only there to revert it.
+type Merge struct {
+	ID         primitive.ObjectID  `json:"id"`
+	SourceID   primitive.ObjectID  `json:"sourceId"`
+	TargetID   primitive.ObjectID  `json:"targetId"`
+	ActorID    primitive.ObjectID  `json:"actorId"`
+	Fields     map[string]string   `json:"fields"`
+	CreateTime int64               `json:"createTime"`
+	RevertTime int64               `json:"revertTime,omitempty"`
+	RevertedBy *primitive.ObjectID `json:"revertedBy,omitempty"`
+}
+
+func NewMerge(merge models.Merge) Merge {
+	res := Merge{
+		ID:         merge.ID,
+		SourceID:   merge.SourceID,
+		TargetID:   merge.TargetID,
+		ActorID:    merge.ActorID,
+		Fields:     merge.Fields,
+		CreateTime: merge.CreateTime,
+		RevertTime: merge.RevertTime,
+	}
+	if merge.RevertTime > 0 {
+		res.RevertedBy = &merge.RevertedBy
+	}
+	return res
+}
+
+func NewMerges(merges []models.Merge) []Merge {
+	items := make([]Merge, 0, len(merges))
+	for _, merge := range merges {
+		items = append(items, NewMerge(merge))
+	}
+	return items
+}
+
+type DuplicateCandidate struct {
+	ID         primitive.ObjectID `json:"id"`
+	Users      []User             `json:"users"`
+	Reasons    []string           `json:"reasons"`
+	Score      float64            `json:"score"`
+	DetectTime int64              `json:"detectTime"`
+}
@@ -0,0 +1,110 @@
+package responses
+
+import (
+	"context"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReviewItem struct {
+	AdminID    primitive.ObjectID  `json:"adminId"`
+	UserID     primitive.ObjectID  `json:"userId"`
+	Email      string              `json:"email"`
+	FullName   string              `json:"fullName"`
+	Roles      []string            `json:"roles"`
+	ReviewerID *primitive.ObjectID `json:"reviewerId,omitempty"`
+	Decision   string              `json:"decision,omitempty"`
+	Comment    string              `json:"comment,omitempty"`
+	DecidedBy  *primitive.ObjectID `json:"decidedBy,omitempty"`
+	DecideTime int64               `json:"decideTime,omitempty"`
+	ApplyTime  int64               `json:"applyTime,omitempty"`
+	ApplyError string              `json:"applyError,omitempty"`
+}
+
+// ReviewSummary counts the items of a campaign by decision.
+type ReviewSummary struct {
+	Total   int `json:"total"`
+	Decided int `json:"decided"`
+	Kept    int `json:"kept"`
+	Revoked int `json:"revoked"`
+}
+
+type Review struct {
+	ID         primitive.ObjectID  `json:"id"`
+	Name       string              `json:"name"`
+	Status     string              `json:"status"`
+	Summary    ReviewSummary       `json:"summary"`
+	Items      []ReviewItem        `json:"items,omitempty"`
+	CreatedBy  *primitive.ObjectID `json:"createdBy,omitempty"`
+	CreateTime int64               `json:"createTime"`
+	DueTime    int64               `json:"dueTime"`
+	ClosedBy   *primitive.ObjectID `json:"closedBy,omitempty"`
+	CloseTime  int64               `json:"closeTime,omitempty"`
+}
+
+func optionalID(id primitive.ObjectID) *primitive.ObjectID {
+	if id.IsZero() {
+		return nil
+	}
+	return &id
+}
+
+// NewReview lists the items of the campaign only when withItems is set.
+func NewReview(ctx context.Context, review models.Review, withItems bool) Review {
+	res := Review{
+		ID:         review.ID,
+		Name:       review.Name,
+		Status:     review.Status,
+		Summary:    ReviewSummary{Total: len(review.Items)},
+		CreatedBy:  optionalID(review.CreatedBy),
+		CreateTime: review.CreateTime,
+		DueTime:    review.DueTime,
+		ClosedBy:   optionalID(review.ClosedBy),
+		CloseTime:  review.CloseTime,
+	}
+	if withItems {
+		res.Items = make([]ReviewItem, 0, len(review.Items))
+	}
+	for _, item := range review.Items {
+		switch item.Decision {
+		case models.ReviewKeep:
+			res.Summary.Decided++
+			res.Summary.Kept++
+		case models.ReviewRevoke:
+			res.Summary.Decided++
+			res.Summary.Revoked++
+		}
+		if !withItems {
+			continue
+		}
+		email := item.Email
+		if !canViewEmail(ctx, item.UserID) {
+			email = helpers.MaskEmail(email)
+		}
+		res.Items = append(res.Items, ReviewItem{
+			AdminID:    item.AdminID,
+			UserID:     item.UserID,
+			Email:      email,
+			FullName:   item.FullName,
+			Roles:      item.Roles,
+			ReviewerID: optionalID(item.ReviewerID),
+			Decision:   item.Decision,
+			Comment:    item.Comment,
+			DecidedBy:  optionalID(item.DecidedBy),
+			DecideTime: item.DecideTime,
+			ApplyTime:  item.ApplyTime,
+			ApplyError: item.ApplyError,
+		})
+	}
+	return res
+}
+
+func NewReviews(ctx context.Context, reviews []models.Review) []Review {
+	items := make([]Review, 0, len(reviews))
+	for _, review := range reviews {
+		items = append(items, NewReview(ctx, review, false))
+	}
+	return items
+}
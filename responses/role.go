@@ -0,0 +1,36 @@
+package responses
+
+import "github.com/anyshare/anyshare-admin-api/models"
+
+type Role struct {
+	Key                  string   `json:"key"`
+	Name                 string   `json:"name"`
+	Desc                 string   `json:"desc"`
+	Permissions          []string `json:"permissions"`
+	Inherits             []string `json:"inherits"`
+	EffectivePermissions []string `json:"effectivePermissions"`
+	BuiltIn              bool     `json:"builtIn"`
+	CreateTime           int64    `json:"createTime,omitempty"`
+	UpdateTime           int64    `json:"updateTime,omitempty"`
+}
+
+func NewRole(role models.Role, effective []string) Role {
+	item := Role{
+		Key:                  role.Key,
+		Name:                 role.Name,
+		Desc:                 role.Desc,
+		Permissions:          role.Permissions,
+		Inherits:             role.Inherits,
+		EffectivePermissions: effective,
+		BuiltIn:              role.BuiltIn,
+		CreateTime:           role.CreateTime,
+		UpdateTime:           role.UpdateTime,
+	}
+	if item.Permissions == nil {
+		item.Permissions = []string{}
+	}
+	if item.Inherits == nil {
+		item.Inherits = []string{}
+	}
+	return item
+}
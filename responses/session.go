@@ -0,0 +1,20 @@
+package responses
+
+import (
+	"context"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+)
+
+type Session struct {
+	Token string `json:"token"`
+	User  User   `json:"user"`
+}
+
+// NewSession describes a freshly logged in user, who always sees their own
+// unmasked data.
+func NewSession(ctx context.Context, token string, user models.User) Session {
+	ctx = context.WithValue(ctx, enum.ContextKeyUser, user.User)
+	return Session{Token: token, User: NewUser(ctx, user)}
+}
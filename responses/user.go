@@ -0,0 +1,79 @@
+package responses
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// User is the API representation of a user, it never carries the password hash.
+type User struct {
+	ID            primitive.ObjectID     `json:"id"`
+	Email         string                 `json:"email"`
+	FullName      string                 `json:"fullName"`
+	Address       string                 `json:"address"`
+	Desc          string                 `json:"desc"`
+	JoinTime      int64                  `json:"joinTime"`
+	DeleteTime    int64                  `json:"deleteTime,omitempty"`
+	EraseTime     int64                  `json:"eraseTime,omitempty"`
+	LastLoginTime int64                  `json:"lastLoginTime,omitempty"`
+	Version       int64                  `json:"version"`
+	Avatar        map[string]string      `json:"avatar,omitempty"`
+	Attributes    map[string]interface{} `json:"attributes,omitempty"`
+	GroupIDs      []primitive.ObjectID   `json:"groupIds"`
+	Tags          []string               `json:"tags"`
+}
+
+func NewUser(ctx context.Context, user models.User) User {
+	email := user.Email
+	if !canViewEmail(ctx, user.ID) {
+		email = helpers.MaskEmail(email)
+	}
+	res := User{
+		ID:            user.ID,
+		Email:         email,
+		FullName:      user.FullName,
+		Address:       user.Address,
+		Desc:          user.Desc,
+		JoinTime:      user.JoinTime,
+		DeleteTime:    user.DeleteTime,
+		EraseTime:     user.EraseTime,
+		LastLoginTime: user.LastLoginTime,
+		Version:       user.Version,
+		Avatar:        avatarURLs(user),
+		Attributes:    user.Attributes,
+		GroupIDs:      user.GroupIDs,
+		Tags:          user.Tags,
+	}
+	if res.GroupIDs == nil {
+		res.GroupIDs = []primitive.ObjectID{}
+	}
+	if res.Tags == nil {
+		res.Tags = []string{}
+	}
+	return res
+}
+
+// avatarURLs maps every avatar variant size to the URL serving it.
+func avatarURLs(user models.User) map[string]string {
+	if user.Avatar == nil {
+		return nil
+	}
+	urls := map[string]string{}
+	for _, size := range user.Avatar.Sizes {
+		urls[strconv.Itoa(size)] = os.Getenv("PUBLIC_URL") + "/" + models.AvatarKey(user.ID, user.Avatar.Hash, size)
+	}
+	return urls
+}
+
+func NewUsers(ctx context.Context, users []models.User) []User {
+	items := make([]User, 0, len(users))
+	for _, user := range users {
+		items = append(items, NewUser(ctx, user))
+	}
+	return items
+}
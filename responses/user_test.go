@@ -0,0 +1,76 @@
+package responses
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testUser(t *testing.T) (models.User, string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{User: schemas.User{
+		ID:       primitive.NewObjectID(),
+		Email:    "jane@example.com",
+		Password: string(hash),
+		FullName: "Jane Doe",
+		JoinTime: 1700000000,
+	}}
+	return user, string(hash)
+}
+
+func TestResponsesLeaveOutPasswordHash(t *testing.T) {
+	user, hash := testUser(t)
+	ctx := context.Background()
+	outputs := map[string]interface{}{
+		"user":    NewUser(ctx, user),
+		"users":   NewUsers(ctx, []models.User{user}),
+		"admin":   NewAdmin(ctx, models.Admin{ID: primitive.NewObjectID(), UserID: user.ID, User: &user}),
+		"session": NewSession(ctx, "token", user),
+		"history": NewHistories([]models.History{{
+			ID:       primitive.NewObjectID(),
+			RecordID: user.ID,
+			Action:   "password",
+			Changes:  []models.FieldChange{{Field: "password", Before: models.RedactedValue, After: models.RedactedValue}},
+		}}),
+		"merge": NewMerge(models.Merge{
+			ID:               primitive.NewObjectID(),
+			SourceID:         user.ID,
+			TargetID:         primitive.NewObjectID(),
+			Fields:           map[string]string{"password": "source"},
+			ReplacedPassword: hash,
+		}),
+	}
+	for name, output := range outputs {
+		data, err := json.Marshal(output)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if strings.Contains(string(data), hash) {
+			t.Errorf("%s output contains the password hash: %s", name, data)
+		}
+		if strings.Contains(string(data), `"password"`) && name != "history" && name != "merge" {
+			t.Errorf("%s output has a password key: %s", name, data)
+		}
+	}
+}
+
+func TestSessionShowsOwnEmail(t *testing.T) {
+	user, _ := testUser(t)
+	session := NewSession(context.Background(), "token", user)
+	if session.User.Email != user.Email {
+		t.Errorf("session email = %q, want %q", session.User.Email, user.Email)
+	}
+	if masked := NewUser(context.Background(), user).Email; masked == user.Email {
+		t.Errorf("email not masked for a viewer without user.email: %q", masked)
+	}
+}
@@ -0,0 +1,29 @@
+package responses
+
+import (
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type View struct {
+	ID          primitive.ObjectID  `json:"id"`
+	OwnerID     primitive.ObjectID  `json:"ownerId"`
+	Name        string              `json:"name"`
+	Query       map[string][]string `json:"query"`
+	Columns     []string            `json:"columns"`
+	SharedRoles []string            `json:"sharedRoles"`
+	CreateTime  int64               `json:"createTime"`
+	UpdateTime  int64               `json:"updateTime"`
+}
+
+func NewView(view models.View) View {
+	return View(view)
+}
+
+func NewViews(views []models.View) []View {
+	items := make([]View, 0, len(views))
+	for _, view := range views {
+		items = append(items, NewView(view))
+	}
+	return items
+}
@@ -0,0 +1,17 @@
+package responses
+
+import (
+	"context"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func canViewEmail(ctx context.Context, owner primitive.ObjectID) bool {
+	if user, ok := ctx.Value(enum.ContextKeyUser).(schemas.User); ok && user.ID == owner {
+		return true
+	}
+	return helpers.HasPermission(ctx, enum.PermissionUserEmail)
+}
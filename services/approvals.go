@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ApprovalRequired reports whether action needs a second admin's approval.
+// APPROVAL_ACTIONS lists those actions comma separated, all of them when it
+// is not set. Setting it empty turns approvals off.
+func ApprovalRequired(action string) bool {
+	value, ok := os.LookupEnv("APPROVAL_ACTIONS")
+	if !ok {
+		return slices.Contains(models.ApprovalActions, action)
+	}
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == action {
+			return true
+		}
+	}
+	return false
+}
+
+// ApprovalParty reports whether admin requested approval or is the one it
+// acts on, and so may not approve it.
+func ApprovalParty(approval models.Approval, admin models.Admin) bool {
+	return admin.UserID == approval.RequestedBy ||
+		(!approval.TargetID.IsZero() && (admin.UserID == approval.TargetID || admin.ID == approval.TargetID))
+}
+
+// ApproverExists reports whether an active admin who is no party to approval
+// holds every one of permissions, through their permanent roles or active
+// grants, and so could approve a request needing them.
+func ApproverExists(ctx context.Context, approval models.Approval, permissions []string) (bool, error) {
+	cursor, err := models.Collection(models.AdminCollection).Find(ctx, bson.M{"deleteTime": nil})
+	if err != nil {
+		return false, err
+	}
+	admins := []models.Admin{}
+	err = cursor.All(ctx, &admins)
+	if err != nil {
+		return false, err
+	}
+	for _, admin := range admins {
+		if ApprovalParty(approval, admin) {
+			continue
+		}
+		roles, err := AdminRoles(ctx, admin)
+		if err != nil {
+			return false, err
+		}
+		held, err := EffectivePermissions(ctx, roles)
+		if err != nil {
+			return false, err
+		}
+		if !slices.ContainsFunc(permissions, func(permission string) bool {
+			return !slices.Contains(held, permission)
+		}) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ApprovalTTL reads APPROVAL_TTL as a duration such as "24h", the default.
+func ApprovalTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("APPROVAL_TTL"))
+	if err != nil || ttl <= 0 {
+		return 24 * time.Hour
+	}
+	return ttl
+}
+
+// WithIdentity returns ctx acting as user, along with the admin they are, if
+// any, and the permissions their roles grant at this point, active grants
+// included.
+func WithIdentity(ctx context.Context, user schemas.User) (context.Context, error) {
+	admin := models.Admin{}
+	models.Collection(models.AdminCollection).FindOne(ctx, bson.M{
+		"userId":     user.ID,
+		"deleteTime": nil,
+	}).Decode(&admin)
+	roles, err := AdminRoles(ctx, admin)
+	if err != nil {
+		return nil, err
+	}
+	permissions, err := EffectivePermissions(ctx, roles)
+	if err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, enum.ContextKeyUser, user)
+	ctx = context.WithValue(ctx, enum.ContextKeyAdmin, admin)
+	ctx = context.WithValue(ctx, enum.ContextKeyPermissions, permissions)
+	return ctx, nil
+}
+
+// LoadIdentity is WithIdentity for the user with the given id, it fails with
+// mongo.ErrNoDocuments when there is none.
+func LoadIdentity(ctx context.Context, userID primitive.ObjectID) (context.Context, error) {
+	user := schemas.User{}
+	err := mongodb.GetCollection(user).FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return WithIdentity(ctx, user)
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApprovalRequired(t *testing.T) {
+	t.Setenv("APPROVAL_ACTIONS", "")
+	os.Unsetenv("APPROVAL_ACTIONS")
+	for _, action := range models.ApprovalActions {
+		if !ApprovalRequired(action) {
+			t.Errorf("%s needs no approval by default", action)
+		}
+	}
+	if ApprovalRequired("user.update") {
+		t.Error("unknown actions need no approval")
+	}
+
+	t.Setenv("APPROVAL_ACTIONS", "admin.delete, role.escalate")
+	if !ApprovalRequired(models.ApprovalAdminDelete) || !ApprovalRequired(models.ApprovalRoleEscalation) || ApprovalRequired(models.ApprovalUserBulkDelete) {
+		t.Error("APPROVAL_ACTIONS not followed")
+	}
+
+	t.Setenv("APPROVAL_ACTIONS", "")
+	if ApprovalRequired(models.ApprovalAdminDelete) {
+		t.Error("empty APPROVAL_ACTIONS should turn approvals off")
+	}
+}
+
+func TestApprovalTTL(t *testing.T) {
+	t.Setenv("APPROVAL_TTL", "2h")
+	if got := ApprovalTTL(); got != 2*time.Hour {
+		t.Errorf("ApprovalTTL = %v, want 2h", got)
+	}
+	t.Setenv("APPROVAL_TTL", "soon")
+	if got := ApprovalTTL(); got != 24*time.Hour {
+		t.Errorf("ApprovalTTL = %v, want the 24h default", got)
+	}
+}
+
+func TestGainsPermissions(t *testing.T) {
+	roles := testRoles(models.Role{Key: "support", Permissions: []string{enum.PermissionUserRead}})
+	tests := []struct {
+		name  string
+		held  []string
+		roles []string
+		want  bool
+	}{
+		{"new admin", nil, []string{enum.RoleViewer}, true},
+		{"role already inherited", []string{enum.RoleAdmin}, []string{enum.RoleViewer}, false},
+		{"role granting nothing new", []string{enum.RoleViewer}, []string{"support"}, false},
+		{"promotion", []string{enum.RoleViewer}, []string{enum.RoleAdmin}, true},
+		{"removing every role", []string{enum.RoleAdmin}, nil, false},
+	}
+	for _, tt := range tests {
+		if got := gainsPermissions(roles, tt.held, tt.roles); got != tt.want {
+			t.Errorf("%s: gainsPermissions = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApprovalParty(t *testing.T) {
+	requester := models.Admin{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+	target := models.Admin{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+	other := models.Admin{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID()}
+
+	approval := models.Approval{RequestedBy: requester.UserID, TargetID: target.ID}
+	if !ApprovalParty(approval, requester) || !ApprovalParty(approval, target) || ApprovalParty(approval, other) {
+		t.Error("approval by admin id: wrong parties")
+	}
+	// New admins are targeted by user id.
+	approval = models.Approval{RequestedBy: requester.UserID, TargetID: target.UserID}
+	if !ApprovalParty(approval, target) || ApprovalParty(approval, other) {
+		t.Error("approval by user id: wrong parties")
+	}
+	approval = models.Approval{RequestedBy: requester.UserID}
+	if ApprovalParty(approval, models.Admin{UserID: other.UserID}) {
+		t.Error("approval without a target: admin without id is a party")
+	}
+}
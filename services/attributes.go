@@ -0,0 +1,230 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Validator tags admins may use in the rules of an attribute definition.
+var attributeRuleTags = []string{
+	"min", "max", "len", "gt", "gte", "lt", "lte",
+	"email", "url", "alpha", "alphanum", "numeric", "e164", "uuid",
+	"lowercase", "uppercase", "startswith", "endswith", "contains", "excludes",
+}
+
+func AttributeDefinitions(ctx context.Context) ([]models.AttributeDefinition, error) {
+	defs := []models.AttributeDefinition{}
+	cursor, err := models.Collection(models.AttributeCollection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"key": 1}))
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &defs)
+	return defs, err
+}
+
+// CheckAttributeRules reports whether the rules of a definition only use
+// whitelisted tags with parameters the validator accepts for its type.
+func CheckAttributeRules(def models.AttributeDefinition) (ok bool) {
+	if def.Rules == "" {
+		return true
+	}
+	if strings.Contains(def.Rules, "|") {
+		return false
+	}
+	for _, rule := range strings.Split(def.Rules, ",") {
+		tag, _, _ := strings.Cut(rule, "=")
+		if !slices.Contains(attributeRuleTags, tag) {
+			return false
+		}
+	}
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	typ, _, _ := attributeValue(def.Type, nil)
+	if typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	validator.New().Var(reflect.New(typ).Elem().Interface(), def.Rules)
+	return true
+}
+
+func attributeLabel(ctx context.Context, def models.AttributeDefinition) string {
+	if label := def.Labels[helpers.Locale(ctx)]; label != "" {
+		return label
+	}
+	if label := def.Labels["en"]; label != "" {
+		return label
+	}
+	return def.Key
+}
+
+func attributeTag(def models.AttributeDefinition) string {
+	tags := []string{"omitempty"}
+	if def.Required {
+		tags = []string{"required"}
+	}
+	switch def.Type {
+	case models.AttributeTypeEnum:
+		values := make([]string, 0, len(def.EnumValues))
+		for _, value := range def.EnumValues {
+			values = append(values, "'"+value+"'")
+		}
+		tags = append(tags, "oneof="+strings.Join(values, " "))
+	case models.AttributeTypeDate:
+		tags = append(tags, "datetime=2006-01-02")
+	}
+	if def.Rules != "" {
+		tags = append(tags, def.Rules)
+	}
+	return strings.Join(tags, ",")
+}
+
+// attributeValue returns the Go type holding an attribute and converts a
+// decoded JSON value to it. Numbers and booleans are pointers so that
+// "required" can tell a missing value from a zero one.
+func attributeValue(kind string, raw interface{}) (reflect.Type, reflect.Value, bool) {
+	switch kind {
+	case models.AttributeTypeNumber:
+		typ := reflect.TypeOf((*float64)(nil))
+		number, ok := raw.(float64)
+		if raw == nil || !ok {
+			return typ, reflect.Zero(typ), raw == nil
+		}
+		return typ, reflect.ValueOf(&number), true
+	case models.AttributeTypeBoolean:
+		typ := reflect.TypeOf((*bool)(nil))
+		boolean, ok := raw.(bool)
+		if raw == nil || !ok {
+			return typ, reflect.Zero(typ), raw == nil
+		}
+		return typ, reflect.ValueOf(&boolean), true
+	default:
+		typ := reflect.TypeOf("")
+		str, ok := raw.(string)
+		if raw == nil || !ok {
+			return typ, reflect.Zero(typ), raw == nil
+		}
+		return typ, reflect.ValueOf(strings.TrimSpace(str)), true
+	}
+}
+
+// ValidateAttributes checks custom attribute values against their definitions
+// with the request validator, returning the values to store and localized
+// errors keyed by "attributes.<key>".
+func ValidateAttributes(ctx context.Context, input map[string]interface{}) (bson.M, map[string]string, error) {
+	defs, err := AttributeDefinitions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	errs := map[string]string{}
+	for key := range input {
+		if !slices.ContainsFunc(defs, func(def models.AttributeDefinition) bool { return def.Key == key }) {
+			errs["attributes."+key] = helpers.Translate(ctx, "unknownAttribute")
+		}
+	}
+
+	fields := []reflect.StructField{}
+	values := []reflect.Value{}
+	keys := []string{}
+	for _, def := range defs {
+		typ, value, ok := attributeValue(def.Type, input[def.Key])
+		if !ok {
+			errs["attributes."+def.Key] = helpers.Translate(ctx, "invalidAttributeType")
+			continue
+		}
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("A%d", len(fields)),
+			Type: typ,
+			Tag:  reflect.StructTag(fmt.Sprintf("validate:%q label:%q", attributeTag(def), attributeLabel(ctx, def))),
+		})
+		values = append(values, value)
+		keys = append(keys, def.Key)
+	}
+	data := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, value := range values {
+		data.Field(i).Set(value)
+	}
+
+	validate, trans := helpers.NewValidator(ctx)
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		return field.Tag.Get("label")
+	})
+	if err := validate.StructCtx(ctx, data.Interface()); err != nil {
+		for _, fe := range err.(validator.ValidationErrors) {
+			i, _ := strconv.Atoi(strings.TrimPrefix(fe.StructField(), "A"))
+			errs["attributes."+keys[i]] = fe.Translate(trans)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+
+	result := bson.M{}
+	for i, value := range values {
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		if value.Kind() == reflect.String && value.String() == "" {
+			continue
+		}
+		result[keys[i]] = value.Interface()
+	}
+	return result, nil, nil
+}
+
+// AttributeFilter turns "attr.<key>=<value>" query parameters into conditions
+// on the stored attribute values.
+func AttributeFilter(ctx context.Context, query url.Values) (bson.M, error) {
+	filter := bson.M{}
+	var defs []models.AttributeDefinition
+	for param, values := range query {
+		key, ok := strings.CutPrefix(param, "attr.")
+		if !ok {
+			continue
+		}
+		if defs == nil {
+			var err error
+			if defs, err = AttributeDefinitions(ctx); err != nil {
+				return nil, err
+			}
+		}
+		i := slices.IndexFunc(defs, func(def models.AttributeDefinition) bool { return def.Key == key })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown attribute %q", key)
+		}
+		raw := values[0]
+		var value interface{} = raw
+		switch defs[i].Type {
+		case models.AttributeTypeNumber:
+			number, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q must be a number", key)
+			}
+			value = number
+		case models.AttributeTypeBoolean:
+			boolean, err := strconv.ParseBool(raw)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q must be a boolean", key)
+			}
+			value = boolean
+		}
+		filter["attributes."+key] = value
+	}
+	return filter, nil
+}
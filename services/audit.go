@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+	// How long a request waits for room in a full queue before writing its
+	// entry itself.
+	auditQueueWait = 100 * time.Millisecond
+)
+
+// auditRecord collects what a request does while it runs.
+type auditRecord struct {
+	mu    sync.Mutex
+	entry models.AuditEntry
+	start time.Time
+}
+
+// StartAudit returns ctx carrying entry, to be completed while the request
+// runs and queued by FinishAudit.
+func StartAudit(ctx context.Context, entry models.AuditEntry) context.Context {
+	return context.WithValue(ctx, enum.ContextKeyAudit, &auditRecord{entry: entry, start: time.Now()})
+}
+
+// SetAuditActor records who makes the request audited in ctx, if any, along
+// with the admin impersonating them and the API key used, which whatever
+// authenticated the request puts in ctx.
+func SetAuditActor(ctx context.Context, actorID primitive.ObjectID) {
+	if record, ok := ctx.Value(enum.ContextKeyAudit).(*auditRecord); ok {
+		record.mu.Lock()
+		record.entry.ActorID = actorID
+		record.entry.ImpersonatorID, _ = ctx.Value(enum.ContextKeyImpersonator).(primitive.ObjectID)
+		record.entry.APIKeyID, _ = ctx.Value(enum.ContextKeyAPIKey).(string)
+		record.mu.Unlock()
+	}
+}
+
+// auditChange adds a record written by the request audited in ctx, if any.
+func auditChange(ctx context.Context, change models.AuditChange) {
+	if record, ok := ctx.Value(enum.ContextKeyAudit).(*auditRecord); ok {
+		record.mu.Lock()
+		record.entry.Changes = append(record.entry.Changes, change)
+		record.mu.Unlock()
+	}
+}
+
+// FinishAudit completes the entry of the request audited in ctx and queues
+// it. The first record the request wrote, if any, is a more precise target
+// than the one guessed from the route.
+func FinishAudit(ctx context.Context, action string, target models.AuditTarget, status int) {
+	record, ok := ctx.Value(enum.ContextKeyAudit).(*auditRecord)
+	if !ok {
+		return
+	}
+	record.mu.Lock()
+	entry := record.entry
+	record.mu.Unlock()
+	entry.Action = action
+	entry.Target = target
+	if len(entry.Changes) > 0 {
+		entry.Target = models.AuditTarget{Collection: entry.Changes[0].Collection, ID: entry.Changes[0].RecordID.Hex()}
+	}
+	entry.ID = primitive.NewObjectID()
+	entry.Status = status
+	entry.CreateTime = record.start.Unix()
+	entry.Duration = time.Since(record.start).Milliseconds()
+	writeAudit(entry)
+}
+
+var (
+	auditMu     sync.RWMutex
+	auditQueue  chan models.AuditEntry
+	auditDone   chan struct{}
+	auditClosed bool
+)
+
+// StartAuditWriter starts writing queued audit entries in batches, in the
+// background.
+func StartAuditWriter() {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	auditQueue = make(chan models.AuditEntry, 1024)
+	auditDone = make(chan struct{})
+	auditClosed = false
+	go runAuditWriter(auditQueue, auditDone)
+}
+
+// StopAuditWriter writes every entry still queued and returns once done or
+// when ctx is. Entries finished afterwards are written synchronously.
+func StopAuditWriter(ctx context.Context) {
+	auditMu.Lock()
+	if auditQueue == nil || auditClosed {
+		auditMu.Unlock()
+		return
+	}
+	auditClosed = true
+	close(auditQueue)
+	auditMu.Unlock()
+	select {
+	case <-auditDone:
+	case <-ctx.Done():
+		log.Println("audit writer: stopped before the queue was written")
+	}
+}
+
+// writeAudit queues entry, or writes it right away when the writer is not
+// running. When the queue stays full for auditQueueWait the request writes
+// its entry itself, so that the entry is never lost and StopAuditWriter is
+// not held up waiting for room.
+func writeAudit(entry models.AuditEntry) {
+	auditMu.RLock()
+	if auditQueue == nil || auditClosed {
+		auditMu.RUnlock()
+		insertAudit([]models.AuditEntry{entry})
+		return
+	}
+	timer := time.NewTimer(auditQueueWait)
+	defer timer.Stop()
+	select {
+	case auditQueue <- entry:
+		auditMu.RUnlock()
+		return
+	case <-timer.C:
+	}
+	auditMu.RUnlock()
+	insertAudit([]models.AuditEntry{entry})
+}
+
+func runAuditWriter(queue chan models.AuditEntry, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	batch := []models.AuditEntry{}
+	for {
+		select {
+		case entry, ok := <-queue:
+			if !ok {
+				insertAudit(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) < auditBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		insertAudit(batch)
+		batch = batch[:0]
+	}
+}
+
+// insertAudit appends entries to the audit chain, retrying a few times.
+// Entries carry their id already so that a retry skips the ones an earlier
+// attempt wrote. Entries that still fail are logged in full so they can be
+// recovered from the logs.
+func insertAudit(entries []models.AuditEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * 500 * time.Millisecond)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		entries, err = unwrittenAudit(ctx, entries)
+		if err == nil {
+			err = sealAudit(ctx, entries)
+		}
+		if err == nil {
+			err = appendAudit(ctx, entries)
+		}
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+	log.Println("write audit log:", err)
+	for _, entry := range entries {
+		line, _ := json.Marshal(entry)
+		log.Println("audit:", string(line))
+	}
+}
+
+// unwrittenAudit leaves out the entries already in the audit log.
+func unwrittenAudit(ctx context.Context, entries []models.AuditEntry) ([]models.AuditEntry, error) {
+	ids := make([]primitive.ObjectID, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	written, err := models.Collection(models.AuditCollection).Distinct(ctx, "_id", bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil || len(written) == 0 {
+		return entries, err
+	}
+	left := []models.AuditEntry{}
+	for _, entry := range entries {
+		if !slices.Contains(written, interface{}(entry.ID)) {
+			left = append(left, entry)
+		}
+	}
+	return left, nil
+}
+
+// appendAudit chains entries after the head kept on the audit lock and writes
+// them with the new head in one transaction. Taking the next numbers first
+// makes concurrent writers, from other instances, conflict and retry.
+func appendAudit(ctx context.Context, entries []models.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	session, err := models.Collection(models.AuditCollection).Database().Client().StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		locks := models.Collection(models.LockCollection)
+		head := models.Lock{}
+		err := locks.FindOneAndUpdate(ctx, bson.M{"_id": auditLock}, bson.M{
+			"$inc": bson.M{"seq": len(entries)},
+		}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)).Decode(&head)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		chained, hash, err := chainAudit(entries, head.Seq, head.Hash)
+		if err != nil {
+			return nil, err
+		}
+		docs := make([]interface{}, 0, len(chained))
+		for _, entry := range chained {
+			docs = append(docs, entry)
+		}
+		_, err = models.Collection(models.AuditCollection).InsertMany(ctx, docs)
+		if err != nil {
+			return nil, err
+		}
+		_, err = locks.UpdateOne(ctx, bson.M{"_id": auditLock}, bson.M{"$set": bson.M{"hash": hash}})
+		return nil, err
+	})
+	return err
+}
+
+// chainAudit numbers entries after seq and links them from hash, the head of
+// the chain, returning them along with the new head.
+func chainAudit(entries []models.AuditEntry, seq int64, hash string) ([]models.AuditEntry, string, error) {
+	chained := make([]models.AuditEntry, 0, len(entries))
+	for i, entry := range entries {
+		entry.Seq = seq + int64(i) + 1
+		entry.PrevHash = hash
+		entry.Hash = ""
+		doc, err := bson.Marshal(entry)
+		if err != nil {
+			return nil, "", err
+		}
+		hash, err = auditHash(doc)
+		if err != nil {
+			return nil, "", err
+		}
+		entry.Hash = hash
+		chained = append(chained, entry)
+	}
+	return chained, hash, nil
+}
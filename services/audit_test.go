@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSetAuditActor(t *testing.T) {
+	actor := primitive.NewObjectID()
+	impersonator := primitive.NewObjectID()
+	ctx := StartAudit(context.Background(), models.AuditEntry{RequestID: "req-1"})
+	ctx = context.WithValue(ctx, enum.ContextKeyImpersonator, impersonator)
+	ctx = context.WithValue(ctx, enum.ContextKeyAPIKey, "key-1")
+	SetAuditActor(ctx, actor)
+
+	entry := ctx.Value(enum.ContextKeyAudit).(*auditRecord).entry
+	if entry.ActorID != actor || entry.ImpersonatorID != impersonator || entry.APIKeyID != "key-1" || entry.RequestID != "req-1" {
+		t.Errorf("entry = %+v", entry)
+	}
+
+	ctx = StartAudit(context.Background(), models.AuditEntry{})
+	SetAuditActor(ctx, actor)
+	if entry := ctx.Value(enum.ContextKeyAudit).(*auditRecord).entry; !entry.ImpersonatorID.IsZero() || entry.APIKeyID != "" {
+		t.Errorf("plain request: entry = %+v", entry)
+	}
+
+	// Requests not audited are left alone.
+	SetAuditActor(context.Background(), actor)
+}
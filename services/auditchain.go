@@ -0,0 +1,381 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+const auditLock = "audit"
+
+// auditHash hashes a stored audit entry, its hash field left out.
+func auditHash(doc bson.Raw) (string, error) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return "", err
+	}
+	kept := make([][]byte, 0, len(elems))
+	for _, elem := range elems {
+		if elem.Key() != "hash" {
+			kept = append(kept, elem)
+		}
+	}
+	sum := sha256.Sum256(bsoncore.BuildDocumentFromElements(nil, kept...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditSigningKey reads AUDIT_SIGNING_KEY, the base64 seed of the ed25519 key
+// checkpoints are signed with. There is none when it is not set.
+func AuditSigningKey() (ed25519.PrivateKey, error) {
+	value := os.Getenv("AUDIT_SIGNING_KEY")
+	if value == "" {
+		return nil, nil
+	}
+	seed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("AUDIT_SIGNING_KEY must be a base64 ed25519 seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// AuditVerifyKey reads AUDIT_VERIFY_KEY, the base64 ed25519 public key
+// checkpoints are verified with, or derives it from the signing key.
+func AuditVerifyKey() (ed25519.PublicKey, error) {
+	value := os.Getenv("AUDIT_VERIFY_KEY")
+	if value == "" {
+		key, err := AuditSigningKey()
+		if key == nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("AUDIT_VERIFY_KEY must be a base64 ed25519 public key")
+	}
+	return key, nil
+}
+
+func auditKeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// auditCheckpointMessage is what a checkpoint signature covers.
+func auditCheckpointMessage(checkpoint models.AuditCheckpoint) []byte {
+	return []byte(fmt.Sprintf("audit-checkpoint:%d:%s:%d", checkpoint.Seq, checkpoint.Hash, checkpoint.CreateTime))
+}
+
+// SignAuditCheckpoint signs the head of the audit chain unless it is already,
+// or there is no signing key.
+func SignAuditCheckpoint(ctx context.Context) error {
+	key, err := AuditSigningKey()
+	if key == nil {
+		return err
+	}
+	head := models.Lock{}
+	err = models.Collection(models.LockCollection).FindOne(ctx, bson.M{"_id": auditLock}).Decode(&head)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	last := models.AuditCheckpoint{}
+	err = models.Collection(models.AuditCheckpointCollection).FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"seq": -1})).Decode(&last)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if head.Seq == 0 || head.Seq == last.Seq {
+		return nil
+	}
+	checkpoint := models.AuditCheckpoint{
+		ID:         primitive.NewObjectID(),
+		Seq:        head.Seq,
+		Hash:       head.Hash,
+		CreateTime: time.Now().Unix(),
+		KeyID:      auditKeyID(key.Public().(ed25519.PublicKey)),
+	}
+	checkpoint.Signature = ed25519.Sign(key, auditCheckpointMessage(checkpoint))
+	_, err = models.Collection(models.AuditCheckpointCollection).InsertOne(ctx, checkpoint)
+	return err
+}
+
+// RunAuditCheckpoints signs a checkpoint of the audit chain every interval
+// until ctx is done.
+func RunAuditCheckpoints(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := SignAuditCheckpoint(ctx); err != nil {
+				log.Println("audit checkpoint:", err)
+			}
+		}
+	}
+}
+
+// AuditBreak is where the audit chain stops holding.
+type AuditBreak struct {
+	Seq    int64              `json:"seq"`
+	ID     primitive.ObjectID `json:"id,omitempty"`
+	Reason string             `json:"reason"`
+}
+
+// AuditReport is the outcome of walking the audit chain. Signed tells whether
+// checkpoint signatures were checked, which takes a key.
+type AuditReport struct {
+	FirstSeq    int64       `json:"firstSeq"`
+	LastSeq     int64       `json:"lastSeq"`
+	LastHash    string      `json:"lastHash"`
+	Entries     int64       `json:"entries"`
+	Checkpoints int64       `json:"checkpoints"`
+	Signed      bool        `json:"signed"`
+	Break       *AuditBreak `json:"break"`
+}
+
+// auditChain walks audit entries in order, stopping at the first break.
+type auditChain struct {
+	report      AuditReport
+	key         ed25519.PublicKey
+	checkpoints map[int64]models.AuditCheckpoint
+}
+
+func newAuditChain(checkpoints []models.AuditCheckpoint, key ed25519.PublicKey) *auditChain {
+	chain := &auditChain{
+		report:      AuditReport{Signed: key != nil},
+		key:         key,
+		checkpoints: map[int64]models.AuditCheckpoint{},
+	}
+	for _, checkpoint := range checkpoints {
+		chain.checkpoints[checkpoint.Seq] = checkpoint
+	}
+	return chain
+}
+
+func (chain *auditChain) fail(seq int64, id primitive.ObjectID, reason string) bool {
+	chain.report.Break = &AuditBreak{Seq: seq, ID: id, Reason: reason}
+	return false
+}
+
+// add checks the next stored entry, reporting whether the chain still holds.
+// The first one is taken as it is, unless the walk starts at the beginning.
+func (chain *auditChain) add(doc bson.Raw, fromStart bool) bool {
+	entry := models.AuditEntry{}
+	if err := bson.Unmarshal(doc, &entry); err != nil {
+		return chain.fail(chain.report.LastSeq+1, primitive.NilObjectID, "unreadable entry")
+	}
+	report := &chain.report
+	if report.Entries == 0 {
+		report.FirstSeq = entry.Seq
+		if fromStart && (entry.Seq != 1 || entry.PrevHash != "") {
+			return chain.fail(1, entry.ID, "missing entry")
+		}
+	} else if entry.Seq != report.LastSeq+1 {
+		return chain.fail(report.LastSeq+1, entry.ID, "missing entry")
+	} else if entry.PrevHash != report.LastHash {
+		return chain.fail(entry.Seq, entry.ID, "broken link")
+	}
+	hash, err := auditHash(doc)
+	if err != nil || hash != entry.Hash {
+		return chain.fail(entry.Seq, entry.ID, "modified entry")
+	}
+	report.LastSeq = entry.Seq
+	report.LastHash = entry.Hash
+	report.Entries++
+	if checkpoint, ok := chain.checkpoints[entry.Seq]; ok {
+		if checkpoint.Hash != entry.Hash {
+			return chain.fail(entry.Seq, entry.ID, "checkpoint mismatch")
+		}
+		if chain.key != nil && (checkpoint.KeyID != auditKeyID(chain.key) ||
+			!ed25519.Verify(chain.key, auditCheckpointMessage(checkpoint), checkpoint.Signature)) {
+			return chain.fail(entry.Seq, entry.ID, "bad checkpoint signature")
+		}
+		report.Checkpoints++
+	}
+	return true
+}
+
+// finish checks that nothing is missing after the last entry walked, up to
+// seq.
+func (chain *auditChain) finish(seq int64) AuditReport {
+	if chain.report.Break == nil && seq > chain.report.LastSeq {
+		chain.fail(chain.report.LastSeq+1, primitive.NilObjectID, "missing entry")
+	}
+	return chain.report
+}
+
+func auditCheckpoints(ctx context.Context, filter bson.M) ([]models.AuditCheckpoint, error) {
+	cursor, err := models.Collection(models.AuditCheckpointCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"seq": 1}))
+	if err != nil {
+		return nil, err
+	}
+	checkpoints := []models.AuditCheckpoint{}
+	err = cursor.All(ctx, &checkpoints)
+	return checkpoints, err
+}
+
+// VerifyAudit walks the audit chain from its first entry to its head and
+// reports the first break: an entry missing, edited or out of its place, or
+// a checkpoint that does not match. Entries written before the chain existed
+// carry no seq and are left out.
+func VerifyAudit(ctx context.Context) (AuditReport, error) {
+	key, err := AuditVerifyKey()
+	if err != nil {
+		return AuditReport{}, err
+	}
+	head := models.Lock{}
+	err = models.Collection(models.LockCollection).FindOne(ctx, bson.M{"_id": auditLock}).Decode(&head)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return AuditReport{}, err
+	}
+	checkpoints, err := auditCheckpoints(ctx, bson.M{})
+	if err != nil {
+		return AuditReport{}, err
+	}
+	chain := newAuditChain(checkpoints, key)
+	seq := head.Seq
+	if len(checkpoints) > 0 && checkpoints[len(checkpoints)-1].Seq > seq {
+		seq = checkpoints[len(checkpoints)-1].Seq
+	}
+	cursor, err := models.Collection(models.AuditCollection).Find(ctx, bson.M{"seq": bson.M{"$gt": 0}}, options.Find().SetSort(bson.M{"seq": 1}))
+	if err != nil {
+		return AuditReport{}, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if !chain.add(cursor.Current, true) {
+			return chain.report, nil
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return AuditReport{}, err
+	}
+	return chain.finish(seq), nil
+}
+
+// auditExportLine is one line of an exported audit segment, either a
+// checkpoint or an entry as the stored document its hash covers.
+type auditExportLine struct {
+	Checkpoint *auditExportCheckpoint `json:"checkpoint,omitempty"`
+	Entry      []byte                 `json:"entry,omitempty"`
+}
+
+type auditExportCheckpoint struct {
+	Seq        int64  `json:"seq"`
+	Hash       string `json:"hash"`
+	CreateTime int64  `json:"createTime"`
+	KeyID      string `json:"keyId"`
+	Signature  []byte `json:"signature"`
+}
+
+// ExportAudit writes the segment of the audit chain from seq from to seq to
+// as JSON lines, the checkpoints it holds first. The segment ends at the
+// latest checkpoint when to is 0, so that all of it can be verified offline
+// with VerifyAuditExport.
+func ExportAudit(ctx context.Context, from int64, to int64, w io.Writer) error {
+	if to == 0 {
+		last, err := auditCheckpoints(ctx, bson.M{})
+		if err != nil {
+			return err
+		}
+		if len(last) == 0 {
+			return nil
+		}
+		to = last[len(last)-1].Seq
+	}
+	seqs := bson.M{"$gte": max(from, 1), "$lte": to}
+	checkpoints, err := auditCheckpoints(ctx, bson.M{"seq": seqs})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, checkpoint := range checkpoints {
+		err := encoder.Encode(auditExportLine{Checkpoint: &auditExportCheckpoint{
+			Seq:        checkpoint.Seq,
+			Hash:       checkpoint.Hash,
+			CreateTime: checkpoint.CreateTime,
+			KeyID:      checkpoint.KeyID,
+			Signature:  checkpoint.Signature,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	cursor, err := models.Collection(models.AuditCollection).Find(ctx, bson.M{"seq": seqs}, options.Find().SetSort(bson.M{"seq": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err := encoder.Encode(auditExportLine{Entry: cursor.Current}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// VerifyAuditExport checks a segment written by ExportAudit against key: its
+// entries must chain from the first one on and it must end at a checkpoint
+// signed with key.
+func VerifyAuditExport(r io.Reader, key ed25519.PublicKey) (AuditReport, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	checkpoints := []models.AuditCheckpoint{}
+	var chain *auditChain
+	for scanner.Scan() {
+		line := auditExportLine{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return AuditReport{}, err
+		}
+		if line.Checkpoint != nil {
+			checkpoints = append(checkpoints, models.AuditCheckpoint{
+				Seq:        line.Checkpoint.Seq,
+				Hash:       line.Checkpoint.Hash,
+				CreateTime: line.Checkpoint.CreateTime,
+				KeyID:      line.Checkpoint.KeyID,
+				Signature:  line.Checkpoint.Signature,
+			})
+			continue
+		}
+		if chain == nil {
+			chain = newAuditChain(checkpoints, key)
+		}
+		if !chain.add(line.Entry, false) {
+			return chain.report, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return AuditReport{}, err
+	}
+	if chain == nil {
+		chain = newAuditChain(checkpoints, key)
+	}
+	report := chain.finish(0)
+	if report.Break == nil {
+		if _, ok := chain.checkpoints[report.LastSeq]; !ok || report.Entries == 0 {
+			chain.fail(report.LastSeq, primitive.NilObjectID, "no checkpoint at the end")
+		}
+	}
+	return chain.report, nil
+}
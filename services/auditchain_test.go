@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testAuditKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+// testAuditEntries chains n entries from the start, as appendAudit does.
+func testAuditEntries(t *testing.T, n int) []models.AuditEntry {
+	t.Helper()
+	entries := make([]models.AuditEntry, n)
+	for i := range entries {
+		entries[i] = models.AuditEntry{
+			ID:         primitive.NewObjectID(),
+			Action:     "user.update",
+			Method:     "PATCH",
+			Path:       "/users/1",
+			Status:     200,
+			CreateTime: int64(1700000000 + i),
+		}
+	}
+	chained, _, err := chainAudit(entries, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chained
+}
+
+func testAuditCheckpoint(entry models.AuditEntry, key ed25519.PrivateKey) models.AuditCheckpoint {
+	checkpoint := models.AuditCheckpoint{
+		Seq:        entry.Seq,
+		Hash:       entry.Hash,
+		CreateTime: entry.CreateTime + 60,
+		KeyID:      auditKeyID(key.Public().(ed25519.PublicKey)),
+	}
+	checkpoint.Signature = ed25519.Sign(key, auditCheckpointMessage(checkpoint))
+	return checkpoint
+}
+
+func testAuditDoc(t *testing.T, entry models.AuditEntry) bson.Raw {
+	t.Helper()
+	doc, err := bson.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// testAuditExport writes entries and checkpoints the way ExportAudit does.
+func testAuditExport(t *testing.T, entries []models.AuditEntry, checkpoints ...models.AuditCheckpoint) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, checkpoint := range checkpoints {
+		err := encoder.Encode(auditExportLine{Checkpoint: &auditExportCheckpoint{
+			Seq:        checkpoint.Seq,
+			Hash:       checkpoint.Hash,
+			CreateTime: checkpoint.CreateTime,
+			KeyID:      checkpoint.KeyID,
+			Signature:  checkpoint.Signature,
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, entry := range entries {
+		if err := encoder.Encode(auditExportLine{Entry: testAuditDoc(t, entry)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf
+}
+
+func TestChainAudit(t *testing.T) {
+	entries := testAuditEntries(t, 3)
+	for i, entry := range entries {
+		if entry.Seq != int64(i+1) {
+			t.Errorf("entry %d: seq = %d", i, entry.Seq)
+		}
+		if i > 0 && entry.PrevHash != entries[i-1].Hash {
+			t.Errorf("entry %d not linked to the one before", i)
+		}
+		if hash, err := auditHash(testAuditDoc(t, entry)); err != nil || hash != entry.Hash {
+			t.Errorf("entry %d: stored hash %s, hashes to %s (%v)", i, entry.Hash, hash, err)
+		}
+	}
+	if entries[0].PrevHash != "" {
+		t.Errorf("first entry links to %q", entries[0].PrevHash)
+	}
+
+	// A later batch carries on from the head of the chain.
+	more, head, err := chainAudit([]models.AuditEntry{{Action: "user.delete"}}, entries[2].Seq, entries[2].Hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more[0].Seq != 4 || more[0].PrevHash != entries[2].Hash || head != more[0].Hash {
+		t.Errorf("next batch = seq %d, prev %s, head %s", more[0].Seq, more[0].PrevHash, head)
+	}
+}
+
+func TestVerifyAuditExport(t *testing.T) {
+	key := testAuditKey(1)
+	public := key.Public().(ed25519.PublicKey)
+	entries := testAuditEntries(t, 3)
+
+	report, err := VerifyAuditExport(testAuditExport(t, entries, testAuditCheckpoint(entries[2], key)), public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Break != nil {
+		t.Fatalf("intact chain broken: %+v", report.Break)
+	}
+	if report.FirstSeq != 1 || report.LastSeq != 3 || report.LastHash != entries[2].Hash ||
+		report.Entries != 3 || report.Checkpoints != 1 || !report.Signed {
+		t.Errorf("report = %+v", report)
+	}
+
+	// A segment is verified from its first entry on.
+	report, err = VerifyAuditExport(testAuditExport(t, entries[1:], testAuditCheckpoint(entries[2], key)), public)
+	if err != nil || report.Break != nil || report.FirstSeq != 2 || report.Entries != 2 {
+		t.Errorf("segment: report = %+v, %v", report, err)
+	}
+
+	edited := append([]models.AuditEntry{}, entries...)
+	edited[1].Status = 204
+
+	relinked, _, err := chainAudit(append([]models.AuditEntry{}, entries[1:]...), 1, "forged")
+	if err != nil {
+		t.Fatal(err)
+	}
+	relinked = append([]models.AuditEntry{entries[0]}, relinked...)
+
+	tests := []struct {
+		name       string
+		entries    []models.AuditEntry
+		checkpoint models.AuditCheckpoint
+		seq        int64
+		reason     string
+	}{
+		{"edited entry", edited, testAuditCheckpoint(entries[2], key), 2, "modified entry"},
+		{"dropped entry", []models.AuditEntry{entries[0], entries[2]}, testAuditCheckpoint(entries[2], key), 2, "missing entry"},
+		{"relinked entry", relinked, testAuditCheckpoint(relinked[2], key), 2, "broken link"},
+		{"foreign key", entries, testAuditCheckpoint(entries[2], testAuditKey(2)), 3, "bad checkpoint signature"},
+		{"checkpoint of another chain", entries, testAuditCheckpoint(models.AuditEntry{Seq: 3, Hash: entries[1].Hash}, key), 3, "checkpoint mismatch"},
+		{"unsigned tail", entries, testAuditCheckpoint(entries[1], key), 3, "no checkpoint at the end"},
+	}
+	for _, tt := range tests {
+		report, err := VerifyAuditExport(testAuditExport(t, tt.entries, tt.checkpoint), public)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if report.Break == nil {
+			t.Errorf("%s: chain holds", tt.name)
+			continue
+		}
+		if report.Break.Seq != tt.seq || report.Break.Reason != tt.reason {
+			t.Errorf("%s: break = %+v, want %q at %d", tt.name, report.Break, tt.reason, tt.seq)
+		}
+	}
+
+	// Without a key, hashes are still checked but signatures are not.
+	report, err = VerifyAuditExport(testAuditExport(t, entries, testAuditCheckpoint(entries[2], testAuditKey(2))), nil)
+	if err != nil || report.Break != nil || report.Signed {
+		t.Errorf("without a key: report = %+v, %v", report, err)
+	}
+	report, err = VerifyAuditExport(testAuditExport(t, edited, testAuditCheckpoint(entries[2], key)), nil)
+	if err != nil || report.Break == nil || report.Break.Reason != "modified entry" {
+		t.Errorf("without a key, edited entry: report = %+v, %v", report, err)
+	}
+
+	if report, err := VerifyAuditExport(&bytes.Buffer{}, public); err != nil || report.Break == nil {
+		t.Errorf("empty export: report = %+v, %v", report, err)
+	}
+	if _, err := VerifyAuditExport(bytes.NewBufferString("not json\n"), public); err == nil {
+		t.Error("garbage export read")
+	}
+}
+
+func TestAuditChainFromStart(t *testing.T) {
+	entries := testAuditEntries(t, 3)
+
+	chain := newAuditChain(nil, nil)
+	if chain.add(testAuditDoc(t, entries[1]), true) {
+		t.Error("chain without its first entry holds")
+	}
+	if chain.report.Break == nil || chain.report.Break.Seq != 1 || chain.report.Break.Reason != "missing entry" {
+		t.Errorf("break = %+v", chain.report.Break)
+	}
+
+	// Entries cut off after the last one walked are missing too.
+	chain = newAuditChain(nil, nil)
+	for _, entry := range entries {
+		if !chain.add(testAuditDoc(t, entry), true) {
+			t.Fatalf("intact chain broken: %+v", chain.report.Break)
+		}
+	}
+	if report := chain.finish(5); report.Break == nil || report.Break.Seq != 4 || report.Break.Reason != "missing entry" {
+		t.Errorf("truncated chain: break = %+v", report.Break)
+	}
+	if chain.add(bson.Raw{0x05}, true) {
+		t.Error("unreadable entry accepted")
+	}
+}
+
+func TestAuditKeys(t *testing.T) {
+	key := testAuditKey(1)
+	seed := base64.StdEncoding.EncodeToString(key.Seed())
+
+	t.Setenv("AUDIT_SIGNING_KEY", "")
+	t.Setenv("AUDIT_VERIFY_KEY", "")
+	if signing, err := AuditSigningKey(); signing != nil || err != nil {
+		t.Errorf("AuditSigningKey unset = %v, %v", signing, err)
+	}
+	if verify, err := AuditVerifyKey(); verify != nil || err != nil {
+		t.Errorf("AuditVerifyKey unset = %v, %v", verify, err)
+	}
+
+	t.Setenv("AUDIT_SIGNING_KEY", seed)
+	if signing, err := AuditSigningKey(); err != nil || !signing.Equal(key) {
+		t.Errorf("AuditSigningKey = %v, %v", signing, err)
+	}
+	if verify, err := AuditVerifyKey(); err != nil || !verify.Equal(key.Public()) {
+		t.Errorf("AuditVerifyKey from the signing key = %v, %v", verify, err)
+	}
+
+	other := testAuditKey(2).Public().(ed25519.PublicKey)
+	t.Setenv("AUDIT_VERIFY_KEY", base64.StdEncoding.EncodeToString(other))
+	if verify, err := AuditVerifyKey(); err != nil || !verify.Equal(other) {
+		t.Errorf("AuditVerifyKey = %v, %v", verify, err)
+	}
+
+	t.Setenv("AUDIT_SIGNING_KEY", "c2hvcnQ=")
+	if _, err := AuditSigningKey(); err == nil {
+		t.Error("short AUDIT_SIGNING_KEY accepted")
+	}
+	t.Setenv("AUDIT_VERIFY_KEY", "not base64")
+	if _, err := AuditVerifyKey(); err == nil {
+		t.Error("bad AUDIT_VERIFY_KEY accepted")
+	}
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// auditClient is what AuditEntry.Client seals.
+type auditClient struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+}
+
+// auditKeys loads the sealing keys of users, creating the missing ones when
+// create is set. Erased users have none.
+func auditKeys(ctx context.Context, userIDs []primitive.ObjectID, create bool) (map[primitive.ObjectID][]byte, error) {
+	db := models.Collection(models.AuditKeyCollection)
+	keys := map[primitive.ObjectID][]byte{}
+	cursor, err := db.Find(ctx, bson.M{"_id": bson.M{"$in": userIDs}})
+	if err != nil {
+		return nil, err
+	}
+	found := []models.AuditKey{}
+	err = cursor.All(ctx, &found)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range found {
+		keys[key.UserID] = key.Key
+	}
+	if !create {
+		return keys, nil
+	}
+	for _, userID := range userIDs {
+		if _, ok := keys[userID]; ok {
+			continue
+		}
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		key := models.AuditKey{}
+		// Another instance may create it first, both keep the one stored.
+		err := db.FindOneAndUpdate(ctx, bson.M{"_id": userID}, bson.M{
+			"$setOnInsert": models.AuditKey{UserID: userID, Key: secret, CreateTime: time.Now().Unix()},
+		}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&key)
+		if mongo.IsDuplicateKeyError(err) {
+			err = db.FindOne(ctx, bson.M{"_id": userID}).Decode(&key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys[userID] = key.Key
+	}
+	return keys, nil
+}
+
+// sealAudit seals the client details of entries with the key of their actor.
+func sealAudit(ctx context.Context, entries []models.AuditEntry) error {
+	actors := []primitive.ObjectID{}
+	for _, entry := range entries {
+		if !entry.ActorID.IsZero() && entry.Client == nil {
+			actors = append(actors, entry.ActorID)
+		}
+	}
+	if len(actors) == 0 {
+		return nil
+	}
+	keys, err := auditKeys(ctx, actors, true)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		key, ok := keys[entry.ActorID]
+		if !ok || entry.Client != nil {
+			continue
+		}
+		data, _ := json.Marshal(auditClient{IP: entry.IP, UserAgent: entry.UserAgent})
+		entry.Client, err = seal(key, data)
+		if err != nil {
+			return err
+		}
+		entry.IP = ""
+		entry.UserAgent = ""
+	}
+	return nil
+}
+
+// RevealAudit unseals the client details of entries whose actor still has a
+// key, those of erased actors stay empty.
+func RevealAudit(ctx context.Context, entries []models.AuditEntry) error {
+	actors := []primitive.ObjectID{}
+	for _, entry := range entries {
+		if entry.Client != nil {
+			actors = append(actors, entry.ActorID)
+		}
+	}
+	if len(actors) == 0 {
+		return nil
+	}
+	keys, err := auditKeys(ctx, actors, false)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entry := &entries[i]
+		key, ok := keys[entry.ActorID]
+		if !ok || entry.Client == nil {
+			continue
+		}
+		data, err := unseal(key, entry.Client)
+		if err != nil {
+			return err
+		}
+		client := auditClient{}
+		if err := json.Unmarshal(data, &client); err != nil {
+			return err
+		}
+		entry.IP = client.IP
+		entry.UserAgent = client.UserAgent
+	}
+	return nil
+}
+
+func seal(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+func unseal(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// exportAudit lists the audit entries made by the user or writing their
+// record, with the client details of the user's own requests readable.
+func exportAudit(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	cursor, err := models.Collection(models.AuditCollection).Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"actorId": userID},
+		bson.M{"changes.recordId": userID},
+	}}, options.Find().SetSort(bson.M{"createTime": 1}))
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.AuditEntry{}
+	err = cursor.All(ctx, &entries)
+	if err != nil {
+		return nil, err
+	}
+	err = RevealAudit(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		entries[i].Client = nil
+		if entries[i].ActorID != userID {
+			entries[i].IP = ""
+			entries[i].UserAgent = ""
+		}
+	}
+	return entries, nil
+}
+
+// eraseAudit deletes the key sealing the client details of the user. Audit
+// entries cannot change without breaking the chain, and hold no other
+// personal data: the values they changed are in the erased history.
+func eraseAudit(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := models.Collection(models.AuditKeyCollection).DeleteOne(ctx, bson.M{"_id": userID})
+	return err
+}
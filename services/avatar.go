@@ -0,0 +1,165 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Square edge lengths, in pixels, of the generated avatar variants.
+var AvatarSizes = []int{64, 128, 256, 512}
+
+// Uploads are at most 4000×4000 pixels and only a few are processed at
+// once, each holding the decoded image and up to two RGBA copies of it.
+const maxAvatarPixels = 4000 * 4000
+
+var avatarSlots = make(chan struct{}, 2)
+
+var ErrUnsupportedImage = errors.New("unsupported image")
+
+type AvatarVariant struct {
+	Size        int
+	Data        []byte
+	ContentType string
+}
+
+// ProcessAvatar checks the real type of an uploaded image, applies its EXIF
+// orientation and re-encodes center cropped square variants. Re-encoding
+// drops EXIF and any other metadata. The returned hash identifies the upload.
+func ProcessAvatar(data []byte) (string, []AvatarVariant, error) {
+	contentType := mimetype.Detect(data).String()
+	if contentType != "image/jpeg" && contentType != "image/png" && contentType != "image/gif" {
+		return "", nil, ErrUnsupportedImage
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 || config.Width*config.Height > maxAvatarPixels {
+		return "", nil, ErrUnsupportedImage
+	}
+	avatarSlots <- struct{}{}
+	defer func() { <-avatarSlots }()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", nil, ErrUnsupportedImage
+	}
+
+	// Rotating and flipping keep the center, so the square is cropped first
+	// and only it is copied around.
+	square := cropSquare(img)
+	if contentType == "image/jpeg" {
+		square = orient(square, exifOrientation(data))
+	}
+
+	outputType := "image/png"
+	if contentType == "image/jpeg" {
+		outputType = "image/jpeg"
+	}
+	variants := []AvatarVariant{}
+	for i, size := range AvatarSizes {
+		// Images are never upscaled, only the smallest size is always produced.
+		if i > 0 && size > square.Bounds().Dx() {
+			break
+		}
+		buf := bytes.Buffer{}
+		resized := downscale(square, min(size, square.Bounds().Dx()))
+		if outputType == "image/jpeg" {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, resized)
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		variants = append(variants, AvatarVariant{Size: size, Data: buf.Bytes(), ContentType: outputType})
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), variants, nil
+}
+
+// cropSquare copies the centered square of img into a new RGBA image.
+func cropSquare(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return square
+}
+
+// downscale resizes a square image with a box filter, averaging every source
+// pixel covered by a target pixel.
+func downscale(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	if size >= side {
+		return src
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o] = uint8(r / n)
+			dst.Pix[o+1] = uint8(g / n)
+			dst.Pix[o+2] = uint8(b / n)
+			dst.Pix[o+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// orient rotates and flips an image according to an EXIF orientation value.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
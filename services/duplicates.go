@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// Minimum similarity of two normalized names to count as the same name.
+	nameSimilarity = 0.85
+	// Name tokens shared by more users than this are too common to compare on.
+	maxNameBlock = 200
+)
+
+// CanonicalEmail folds the variants of an address that reach the same
+// mailbox: "+tag" suffixes and, for Gmail, dots in the local part.
+func CanonicalEmail(email string) string {
+	local, domain, ok := strings.Cut(helpers.NormalizeEmail(email), "@")
+	if !ok {
+		return local
+	}
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+// canonicalName normalizes a name and sorts its words, so that reordered
+// names compare equal.
+func canonicalName(name string) []string {
+	tokens := strings.Fields(helpers.NormalizeSearchText(name))
+	sort.Strings(tokens)
+	return tokens
+}
+
+// similarity is one minus the edit distance of a and b relative to the
+// longer of them.
+func similarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return 1 - float64(prev[len(rb)])/float64(max(len(ra), len(rb)))
+}
+
+type duplicatePair struct {
+	a, b  primitive.ObjectID
+	email bool
+	name  float64
+	addr  bool
+}
+
+// FindDuplicates compares active users pairwise within blocks sharing a
+// canonical email, an address or a name word. Pairs are reported when their
+// emails match, or when their names are similar and they share an address.
+func FindDuplicates(ctx context.Context) ([]models.DuplicateCandidate, error) {
+	opts := options.Find().SetProjection(bson.M{"email": 1, "fullName": 1, "address": 1})
+	cursor, err := mongodb.GetCollection(schemas.User{}).Find(ctx, bson.M{"deleteTime": nil}, opts)
+	if err != nil {
+		return nil, err
+	}
+	users := []schemas.User{}
+	err = cursor.All(ctx, &users)
+	if err != nil {
+		return nil, err
+	}
+
+	emails := map[string][]int{}
+	addresses := map[string][]int{}
+	names := map[string][]int{}
+	canonicalNames := make([]string, len(users))
+	for i, user := range users {
+		emails[CanonicalEmail(user.Email)] = append(emails[CanonicalEmail(user.Email)], i)
+		if address := helpers.NormalizeSearchText(user.Address); address != "" {
+			addresses[address] = append(addresses[address], i)
+		}
+		tokens := canonicalName(user.FullName)
+		canonicalNames[i] = strings.Join(tokens, " ")
+		for _, token := range tokens {
+			names[token] = append(names[token], i)
+		}
+	}
+
+	pairs := map[[2]int]*duplicatePair{}
+	pair := func(i, j int) *duplicatePair {
+		if i > j {
+			i, j = j, i
+		}
+		key := [2]int{i, j}
+		if pairs[key] == nil {
+			pairs[key] = &duplicatePair{a: users[i].ID, b: users[j].ID, name: -1}
+		}
+		return pairs[key]
+	}
+	for _, block := range emails {
+		for x := range block {
+			for _, j := range block[x+1:] {
+				pair(block[x], j).email = true
+			}
+		}
+	}
+	for _, block := range addresses {
+		for x := range block {
+			for _, j := range block[x+1:] {
+				pair(block[x], j).addr = true
+			}
+		}
+	}
+	for _, block := range names {
+		if len(block) > maxNameBlock {
+			continue
+		}
+		for x := range block {
+			for _, j := range block[x+1:] {
+				p := pair(block[x], j)
+				if p.name < 0 {
+					p.name = similarity(canonicalNames[block[x]], canonicalNames[j])
+				}
+			}
+		}
+	}
+
+	now := time.Now().Unix()
+	candidates := []models.DuplicateCandidate{}
+	for key, p := range pairs {
+		if p.name < 0 {
+			p.name = similarity(canonicalNames[key[0]], canonicalNames[key[1]])
+		}
+		similarName := p.name >= nameSimilarity
+		if !p.email && !(similarName && p.addr) {
+			continue
+		}
+		candidate := models.DuplicateCandidate{UserIDs: []primitive.ObjectID{p.a, p.b}, DetectTime: now}
+		if p.email {
+			candidate.Reasons = append(candidate.Reasons, models.DuplicateReasonEmail)
+			candidate.Score += 0.5
+		}
+		if similarName {
+			candidate.Reasons = append(candidate.Reasons, models.DuplicateReasonName)
+			candidate.Score += 0.3 * p.name
+		}
+		if p.addr {
+			candidate.Reasons = append(candidate.Reasons, models.DuplicateReasonAddress)
+			candidate.Score += 0.2
+		}
+		candidates = append(candidates, candidate)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates, nil
+}
+
+// DetectDuplicates replaces the stored duplicate candidates with a new scan.
+func DetectDuplicates(ctx context.Context) error {
+	candidates, err := FindDuplicates(ctx)
+	if err != nil {
+		return err
+	}
+	db := models.Collection(models.DuplicateCollection)
+	_, err = db.DeleteMany(ctx, bson.M{})
+	if err != nil || len(candidates) == 0 {
+		return err
+	}
+	docs := make([]interface{}, 0, len(candidates))
+	for _, candidate := range candidates {
+		docs = append(docs, candidate)
+	}
+	_, err = db.InsertMany(ctx, docs)
+	return err
+}
+
+// RunDuplicateDetection scans for duplicates every interval until ctx is done.
+func RunDuplicateDetection(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := DetectDuplicates(ctx); err != nil {
+			log.Println("detect duplicates:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// GrantMaxDuration reads GRANT_MAX_DURATION as a duration such as "24h", the
+// default.
+func GrantMaxDuration() time.Duration {
+	duration, err := time.ParseDuration(os.Getenv("GRANT_MAX_DURATION"))
+	if err != nil || duration <= 0 {
+		return 24 * time.Hour
+	}
+	return duration
+}
+
+// GrantFilter matches the grants in the given status at the given unix time,
+// any status when it is empty.
+func GrantFilter(status string, now int64) bson.M {
+	switch status {
+	case models.GrantActive:
+		return bson.M{"revokeTime": nil, "startTime": bson.M{"$lte": now}, "endTime": bson.M{"$gt": now}}
+	case models.GrantScheduled:
+		return bson.M{"revokeTime": nil, "startTime": bson.M{"$gt": now}}
+	case models.GrantExpired:
+		return bson.M{"revokeTime": nil, "endTime": bson.M{"$lte": now}}
+	case models.GrantRevoked:
+		return bson.M{"revokeTime": bson.M{"$gt": 0}}
+	}
+	return bson.M{}
+}
+
+// GrantedRoles returns the roles held by admin through grants active now.
+func GrantedRoles(ctx context.Context, admin models.Admin) ([]string, error) {
+	filter := GrantFilter(models.GrantActive, time.Now().Unix())
+	filter["adminId"] = admin.ID
+	values, err := models.Collection(models.GrantCollection).Distinct(ctx, "role", filter)
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(values))
+	for _, value := range values {
+		if role, ok := value.(string); ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+// AdminRoles returns the permanent roles of admin followed by the ones it
+// holds through active grants.
+func AdminRoles(ctx context.Context, admin models.Admin) ([]string, error) {
+	if admin.ID.IsZero() {
+		return admin.Roles, nil
+	}
+	granted, err := GrantedRoles(ctx, admin)
+	if err != nil {
+		return nil, err
+	}
+	roles := slices.Clone(admin.Roles)
+	for _, role := range granted {
+		if !slices.Contains(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
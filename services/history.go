@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	HistoryActionCreate   = "create"
+	HistoryActionUpdate   = "update"
+	HistoryActionPassword = "password"
+	HistoryActionDelete   = "delete"
+	HistoryActionMerge    = "merge"
+	HistoryActionUnmerge  = "unmerge"
+)
+
+// Fields whose values never reach the history, only the fact they changed.
+var historySecretFields = []string{"password"}
+
+// RecordHistory stores the fields of update that differ from before, along
+// with the user acting in ctx and the approval it runs under, if any, and
+// adds them to the audit entry of the request. Fields missing from before are
+// not tracked unless they are secret.
+func RecordHistory(ctx context.Context, collection string, recordID primitive.ObjectID, action string, before bson.M, update bson.M) error {
+	changes := historyChanges(before, update)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	historyID := primitive.NewObjectID()
+	changed := make([]string, 0, len(changes))
+	for _, change := range changes {
+		changed = append(changed, change.Field)
+	}
+	auditChange(ctx, models.AuditChange{Collection: collection, RecordID: recordID, Action: action, HistoryID: historyID, Fields: changed})
+
+	actor, _ := ctx.Value(enum.ContextKeyUser).(schemas.User)
+	approval, _ := ctx.Value(enum.ContextKeyApproval).(models.Approval)
+	_, err := models.Collection(models.HistoryCollection).InsertOne(ctx, models.History{
+		ID:         historyID,
+		Collection: collection,
+		RecordID:   recordID,
+		ActorID:    actor.ID,
+		ApproverID: approval.ReviewedBy,
+		ApprovalID: approval.ID,
+		Action:     action,
+		Changes:    changes,
+		CreateTime: time.Now().Unix(),
+	})
+	return err
+}
+
+// historyChanges lists the fields of update that differ from before, sorted,
+// with the values of secret fields redacted.
+func historyChanges(before bson.M, update bson.M) []models.FieldChange {
+	fields := make([]string, 0, len(update))
+	for field := range update {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, field := range fields {
+		if slices.Contains(historySecretFields, field) {
+			changes = append(changes, models.FieldChange{Field: field, Before: models.RedactedValue, After: models.RedactedValue})
+			continue
+		}
+		value, tracked := before[field]
+		if !tracked || reflect.DeepEqual(value, update[field]) {
+			continue
+		}
+		changes = append(changes, models.FieldChange{Field: field, Before: value, After: update[field]})
+	}
+	return changes
+}
+
+// RecordAsOf rebuilds a record as it was at the given unix time by reverting,
+// newest first, every change recorded after it. Secret and erased fields are
+// left as is.
+func RecordAsOf(ctx context.Context, collection string, current bson.M, at int64) (bson.M, error) {
+	cursor, err := models.Collection(models.HistoryCollection).Find(ctx, bson.M{
+		"collection": collection,
+		"recordId":   current["_id"],
+		"createTime": bson.M{"$gt": at},
+	}, options.Find().SetSort(bson.D{{Key: "createTime", Value: -1}, {Key: "_id", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	record := bson.M{}
+	for key, value := range current {
+		record[key] = value
+	}
+	for cursor.Next(ctx) {
+		entry := models.History{}
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, err
+		}
+		revertChanges(record, entry.Changes)
+	}
+	return record, cursor.Err()
+}
+
+// revertChanges sets the fields of record back to their values before
+// changes, leaving secret and redacted ones as they are.
+func revertChanges(record bson.M, changes []models.FieldChange) {
+	for _, change := range changes {
+		if slices.Contains(historySecretFields, change.Field) || change.Before == models.RedactedValue {
+			continue
+		}
+		if change.Before == nil {
+			delete(record, change.Field)
+		} else {
+			record[change.Field] = change.Before
+		}
+	}
+}
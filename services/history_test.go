@@ -0,0 +1,49 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestHistoryChanges(t *testing.T) {
+	hash := "$2a$10$abcdefghijklmnopqrstuvCDEFGHIJKLMNOPQRSTUVWXYZ012345"
+	before := bson.M{"fullName": "Jane", "address": "Here", "tags": []string{}}
+	update := bson.M{"fullName": "Jane Doe", "address": "Here", "password": hash, "untracked": 1}
+	got := historyChanges(before, update)
+	want := []models.FieldChange{
+		{Field: "fullName", Before: "Jane", After: "Jane Doe"},
+		{Field: "password", Before: models.RedactedValue, After: models.RedactedValue},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("historyChanges = %#v, want %#v", got, want)
+	}
+}
+
+func TestRevertChanges(t *testing.T) {
+	record := bson.M{"fullName": "Jane Doe", "password": "current", "desc": "added"}
+	revertChanges(record, []models.FieldChange{
+		{Field: "fullName", Before: "Jane", After: "Jane Doe"},
+		{Field: "password", Before: models.RedactedValue, After: models.RedactedValue},
+		{Field: "desc", Before: nil, After: "added"},
+	})
+	want := bson.M{"fullName": "Jane", "password": "current"}
+	if !reflect.DeepEqual(record, want) {
+		t.Errorf("reverted record = %v, want %v", record, want)
+	}
+}
+
+func TestExportedUserLeavesOutSecrets(t *testing.T) {
+	user := exportedUser(bson.M{"email": "jane@example.com", "password": "$2a$10$hash", "search": bson.M{"email": "jane"}})
+	if _, ok := user["password"]; ok {
+		t.Error("export has the password hash")
+	}
+	if _, ok := user["search"]; ok {
+		t.Error("export has the search keys")
+	}
+	if user["email"] != "jane@example.com" {
+		t.Errorf("export email = %v", user["email"])
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrLastSuperAdmin = errors.New("at least one active superadmin is required")
+	ErrSelfDelete     = errors.New("admins cannot delete themselves")
+	ErrSelfDemote     = errors.New("admins cannot remove their own highest role")
+)
+
+const superAdminLock = "superadmin"
+
+// IsSuperAdmin reports whether keys hold or inherit the superadmin role.
+func IsSuperAdmin(roles map[string]models.Role, keys []string) bool {
+	return InheritsRole(roles, keys, enum.RoleSuperAdmin)
+}
+
+// HighestRole returns the role of keys granting the most permissions, the
+// first one on ties.
+func HighestRole(roles map[string]models.Role, keys []string) string {
+	highest, most := "", -1
+	for _, key := range keys {
+		if count := len(resolvePermissions(roles, []string{key})); count > most {
+			highest, most = key, count
+		}
+	}
+	return highest
+}
+
+// CheckOwnRoles returns ErrSelfDemote when an admin replacing their own roles
+// by keys would lose their highest role, holding or inheriting it is enough.
+func CheckOwnRoles(ctx context.Context, admin models.Admin, keys []string) error {
+	actor, _ := ctx.Value(enum.ContextKeyAdmin).(models.Admin)
+	if actor.ID.IsZero() || actor.ID != admin.ID {
+		return nil
+	}
+	roles, err := Roles(ctx)
+	if err != nil {
+		return err
+	}
+	return checkOwnRoles(roles, admin.Roles, keys)
+}
+
+func checkOwnRoles(roles map[string]models.Role, held []string, keys []string) error {
+	if highest := HighestRole(roles, held); highest != "" && !InheritsRole(roles, keys, highest) {
+		return ErrSelfDemote
+	}
+	return nil
+}
+
+// CheckSelf returns ErrSelfDelete when userID is the user acting in ctx.
+func CheckSelf(ctx context.Context, userID primitive.ObjectID) error {
+	actor, ok := ctx.Value(enum.ContextKeyUser).(schemas.User)
+	if ok && actor.ID == userID {
+		return ErrSelfDelete
+	}
+	return nil
+}
+
+// countSuperAdmins counts the admins holding a superadmin role whose user
+// account is neither deleted nor erased.
+func countSuperAdmins(ctx context.Context) (int64, error) {
+	roles, err := Roles(ctx)
+	if err != nil {
+		return 0, err
+	}
+	keys := []string{}
+	for key := range roles {
+		if IsSuperAdmin(roles, []string{key}) {
+			keys = append(keys, key)
+		}
+	}
+	userIDs, err := models.Collection(models.AdminCollection).Distinct(ctx, "userId", bson.M{
+		"deleteTime": nil,
+		"roles":      bson.M{"$in": keys},
+	})
+	if err != nil || len(userIDs) == 0 {
+		return 0, err
+	}
+	return mongodb.GetCollection(schemas.User{}).CountDocuments(ctx, bson.M{
+		"_id":        bson.M{"$in": userIDs},
+		"deleteTime": nil,
+	})
+}
+
+// GuardAdmins runs change, a write which may take superadmin rights away, in
+// a transaction that is aborted with ErrLastSuperAdmin when no active
+// superadmin would be left. Every guarded transaction first bumps the same
+// lock document, so concurrent ones conflict and are retried on top of each
+// other instead of each removing a different superadmin.
+func GuardAdmins(ctx context.Context, change func(ctx mongo.SessionContext) (*mongo.UpdateResult, error)) (*mongo.UpdateResult, error) {
+	session, err := mongodb.GetCollection(schemas.User{}).Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result, err := session.WithTransaction(ctx, func(ctx mongo.SessionContext) (interface{}, error) {
+		_, err := models.Collection(models.LockCollection).UpdateOne(ctx, bson.M{"_id": superAdminLock}, bson.M{
+			"$inc": bson.M{"seq": 1},
+		}, options.Update().SetUpsert(true))
+		if err != nil {
+			return nil, err
+		}
+		result, err := change(ctx)
+		if err != nil || result.ModifiedCount == 0 {
+			return result, err
+		}
+		count, err := countSuperAdmins(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			return nil, ErrLastSuperAdmin
+		}
+		return result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.(*mongo.UpdateResult), nil
+}
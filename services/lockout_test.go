@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIsSuperAdmin(t *testing.T) {
+	roles := testRoles(models.Role{Key: "owner", Inherits: []string{enum.RoleSuperAdmin}})
+	tests := []struct {
+		keys []string
+		want bool
+	}{
+		{[]string{enum.RoleSuperAdmin}, true},
+		{[]string{enum.RoleViewer, "owner"}, true},
+		{[]string{enum.RoleAdmin}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsSuperAdmin(roles, tt.keys); got != tt.want {
+			t.Errorf("IsSuperAdmin(%v) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestHighestRole(t *testing.T) {
+	roles := testRoles()
+	if got := HighestRole(roles, []string{enum.RoleViewer, enum.RoleAdmin}); got != enum.RoleAdmin {
+		t.Errorf("HighestRole = %q, want admin", got)
+	}
+	if got := HighestRole(roles, nil); got != "" {
+		t.Errorf("HighestRole of no roles = %q", got)
+	}
+}
+
+func TestCheckOwnRoles(t *testing.T) {
+	roles := testRoles(models.Role{Key: "owner", Inherits: []string{enum.RoleSuperAdmin}})
+	tests := []struct {
+		name string
+		held []string
+		keys []string
+		want error
+	}{
+		{"keeps highest role", []string{enum.RoleSuperAdmin, enum.RoleViewer}, []string{enum.RoleSuperAdmin}, nil},
+		{"keeps it through inheritance", []string{enum.RoleSuperAdmin}, []string{"owner"}, nil},
+		{"drops highest role", []string{enum.RoleSuperAdmin, enum.RoleViewer}, []string{enum.RoleViewer}, ErrSelfDemote},
+		{"drops every role", []string{enum.RoleAdmin}, nil, ErrSelfDemote},
+		{"had no role", nil, nil, nil},
+	}
+	for _, tt := range tests {
+		if got := checkOwnRoles(roles, tt.held, tt.keys); got != tt.want {
+			t.Errorf("%s: checkOwnRoles = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Changing the roles of someone else is never a self demotion.
+	actor := models.Admin{ID: primitive.NewObjectID()}
+	ctx := context.WithValue(context.Background(), enum.ContextKeyAdmin, actor)
+	if err := CheckOwnRoles(ctx, models.Admin{ID: primitive.NewObjectID(), Roles: []string{enum.RoleSuperAdmin}}, nil); err != nil {
+		t.Errorf("CheckOwnRoles on another admin = %v", err)
+	}
+}
+
+func TestCheckSelf(t *testing.T) {
+	actor := schemas.User{ID: primitive.NewObjectID()}
+	ctx := context.WithValue(context.Background(), enum.ContextKeyUser, actor)
+	if err := CheckSelf(ctx, actor.ID); err != ErrSelfDelete {
+		t.Errorf("CheckSelf on self = %v, want ErrSelfDelete", err)
+	}
+	if err := CheckSelf(ctx, primitive.NewObjectID()); err != nil {
+		t.Errorf("CheckSelf on another user = %v", err)
+	}
+	if err := CheckSelf(context.Background(), actor.ID); err != nil {
+		t.Errorf("CheckSelf without an actor = %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-admin-api/storage"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const HistoryActionErase = "erase"
+
+// PrivacyHandler exports and erases what one collection holds on a user.
+// Export returns a value marshalled to <Name>.json in the export archive,
+// Erase removes or anonymizes the data while keeping documents other
+// collections refer to.
+type PrivacyHandler struct {
+	Name   string
+	Export func(ctx context.Context, userID primitive.ObjectID) (interface{}, error)
+	Erase  func(ctx context.Context, userID primitive.ObjectID) error
+}
+
+var privacyHandlers []PrivacyHandler
+
+// RegisterPrivacyHandler adds a handler to data subject exports and erasures,
+// handlers run in registration order.
+func RegisterPrivacyHandler(handler PrivacyHandler) {
+	privacyHandlers = append(privacyHandlers, handler)
+}
+
+func init() {
+	// Invitations and approvals find the user by email, so they run before
+	// the account is anonymized.
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.InvitationCollection, Export: exportInvitations, Erase: eraseInvitations})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.ApprovalCollection, Erase: eraseApprovals})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.UserCollection, Export: exportUser, Erase: eraseUser})
+	RegisterPrivacyHandler(PrivacyHandler{Name: "user_tokens", Export: exportUserTokens, Erase: eraseUserTokens})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.AdminCollection, Export: exportAdmin, Erase: eraseAdmin})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.HistoryCollection, Export: exportHistories, Erase: eraseHistories})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.MergeCollection, Export: exportMerges, Erase: eraseMerges})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.AuditCollection, Export: exportAudit, Erase: eraseAudit})
+	RegisterPrivacyHandler(PrivacyHandler{Name: models.ReviewCollection, Export: exportReviews, Erase: eraseReviews})
+}
+
+// ExportUserData writes a ZIP archive with one JSON document per handler.
+func ExportUserData(ctx context.Context, userID primitive.ObjectID, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, handler := range privacyHandlers {
+		if handler.Export == nil {
+			continue
+		}
+		data, err := handler.Export(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", handler.Name, err)
+		}
+		file, err := archive.Create(handler.Name + ".json")
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(data)
+		if err != nil {
+			return fmt.Errorf("export %s: %w", handler.Name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// EraseUserData runs every eraser, then records the erasure in the history
+// without any of the erased values.
+func EraseUserData(ctx context.Context, userID primitive.ObjectID) error {
+	changes := []models.FieldChange{}
+	for _, handler := range privacyHandlers {
+		if handler.Erase == nil {
+			continue
+		}
+		err := handler.Erase(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("erase %s: %w", handler.Name, err)
+		}
+		changes = append(changes, models.FieldChange{Field: handler.Name, Before: models.RedactedValue, After: models.RedactedValue})
+	}
+	actor, _ := ctx.Value(enum.ContextKeyUser).(schemas.User)
+	_, err := models.Collection(models.HistoryCollection).InsertOne(ctx, models.History{
+		Collection: models.UserCollection,
+		RecordID:   userID,
+		ActorID:    actor.ID,
+		Action:     HistoryActionErase,
+		Changes:    changes,
+		CreateTime: time.Now().Unix(),
+	})
+	return err
+}
+
+func exportUser(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	user := bson.M{}
+	err := mongodb.GetCollection(schemas.User{}).FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+	return exportedUser(user), nil
+}
+
+// exportedUser leaves the password hash and search keys out of a user
+// document.
+func exportedUser(user bson.M) bson.M {
+	delete(user, "password")
+	delete(user, "search")
+	return user
+}
+
+// eraseUser anonymizes the user document in place so that references to its
+// id stay valid. The email keeps a unique placeholder and the account is
+// deleted if it was not already.
+func eraseUser(ctx context.Context, userID primitive.ObjectID) error {
+	db := mongodb.GetCollection(schemas.User{})
+	user := models.User{}
+	err := db.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	if err != nil {
+		return err
+	}
+	if user.Avatar != nil {
+		for _, size := range user.Avatar.Sizes {
+			err := storage.Default().Delete(ctx, models.AvatarKey(userID, user.Avatar.Hash, size))
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	now := time.Now().Unix()
+	email := "erased-" + userID.Hex() + "@invalid"
+	fullName := "Erased user"
+	set := bson.M{
+		"email":     email,
+		"password":  "",
+		"fullName":  fullName,
+		"address":   "",
+		"desc":      "",
+		"search":    UserSearchFields(email, fullName, ""),
+		"eraseTime": now,
+	}
+	if user.DeleteTime == 0 {
+		set["deleteTime"] = now
+	}
+	_, err = db.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{
+		"$set":   set,
+		"$unset": bson.M{"avatar": "", "attributes": "", "tags": ""},
+		"$inc":   bson.M{"version": 1},
+	})
+	return err
+}
+
+// userEmail returns the email of the user, which others may hold a copy of.
+func userEmail(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	user := schemas.User{}
+	err := mongodb.GetCollection(user).FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	return user.Email, err
+}
+
+func invitationFilter(userID primitive.ObjectID, email string) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"userId": userID}, bson.M{"email": email}}}
+}
+
+// exportInvitations leaves out token hashes.
+func exportInvitations(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	email, err := userEmail(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	invitations := []bson.M{}
+	opts := options.Find().SetProjection(bson.M{"tokenHash": 0})
+	cursor, err := models.Collection(models.InvitationCollection).Find(ctx, invitationFilter(userID, email), opts)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &invitations)
+	return invitations, err
+}
+
+// eraseInvitations revokes the pending invitations of the user and replaces
+// their email in all of them.
+func eraseInvitations(ctx context.Context, userID primitive.ObjectID) error {
+	email, err := userEmail(ctx, userID)
+	if err != nil {
+		return err
+	}
+	db := models.Collection(models.InvitationCollection)
+	filter := invitationFilter(userID, email)
+	_, err = db.UpdateMany(ctx, bson.M{"$and": bson.A{filter, bson.M{"acceptTime": nil, "revokeTime": nil}}}, bson.M{
+		"$set": bson.M{"revokeTime": time.Now().Unix()},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"email": "erased-" + userID.Hex() + "@invalid"}})
+	return err
+}
+
+// eraseApprovals drops the stored requests mentioning the email of the user,
+// such as invitations waiting for approval, and rejects those still pending
+// since they can no longer run. Request bodies are not exported, they belong
+// to the requester.
+func eraseApprovals(ctx context.Context, userID primitive.ObjectID) error {
+	email, err := userEmail(ctx, userID)
+	if err != nil || email == "" {
+		return err
+	}
+	// Bodies are stored as encoded by encoding/json, which escapes the email
+	// the same way.
+	needle, err := json.Marshal(email)
+	if err != nil {
+		return err
+	}
+	db := models.Collection(models.ApprovalCollection)
+	cursor, err := db.Find(ctx, bson.M{"body": bson.M{"$ne": nil}}, options.Find().SetProjection(bson.M{"body": 1}))
+	if err != nil {
+		return err
+	}
+	approvals := []models.Approval{}
+	err = cursor.All(ctx, &approvals)
+	if err != nil {
+		return err
+	}
+	ids := []primitive.ObjectID{}
+	for _, approval := range approvals {
+		if bytes.Contains(approval.Body, needle) {
+			ids = append(ids, approval.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err = db.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}, "status": models.ApprovalPending}, bson.M{
+		"$set": bson.M{"status": models.ApprovalRejected, "reviewTime": time.Now().Unix()},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = db.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{"$unset": bson.M{"body": ""}})
+	return err
+}
+
+func exportUserTokens(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	tokens := []schemas.UserToken{}
+	cursor, err := mongodb.GetCollection(schemas.UserToken{}).Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &tokens)
+	if err != nil {
+		return nil, err
+	}
+	// Token ids are bearer secrets, only the session details are exported.
+	sessions := make([]bson.M, 0, len(tokens))
+	for _, token := range tokens {
+		sessions = append(sessions, bson.M{"userAgent": token.UserAgent, "createTime": token.CreateTime})
+	}
+	return sessions, nil
+}
+
+func eraseUserTokens(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := mongodb.GetCollection(schemas.UserToken{}).DeleteMany(ctx, bson.M{"userId": userID})
+	return err
+}
+
+func exportAdmin(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	admins := []bson.M{}
+	cursor, err := models.Collection(models.AdminCollection).Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &admins)
+	return admins, err
+}
+
+// eraseAdmin revokes the admin role, the document holds no personal data and
+// is kept for the records referring to it.
+func eraseAdmin(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := models.Collection(models.AdminCollection).UpdateMany(ctx, bson.M{"userId": userID, "deleteTime": nil}, bson.M{
+		"$set": bson.M{"deleteTime": time.Now().Unix()},
+		"$inc": bson.M{"version": 1},
+	})
+	return err
+}
+
+func exportHistories(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	entries := []models.History{}
+	cursor, err := models.Collection(models.HistoryCollection).Find(ctx, bson.M{"collection": models.UserCollection, "recordId": userID})
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &entries)
+	return entries, err
+}
+
+// eraseHistories redacts the values recorded for the user, the entries and
+// their actors are kept.
+func eraseHistories(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := models.Collection(models.HistoryCollection).UpdateMany(ctx, bson.M{"collection": models.UserCollection, "recordId": userID}, bson.M{
+		"$set": bson.M{
+			"changes.$[].before": models.RedactedValue,
+			"changes.$[].after":  models.RedactedValue,
+		},
+	})
+	return err
+}
+
+func mergeFilter(userID primitive.ObjectID) bson.M {
+	return bson.M{"$or": bson.A{bson.M{"sourceId": userID}, bson.M{"targetId": userID}}}
+}
+
+// exportMerges leaves out the snapshots, they hold the other user as well.
+func exportMerges(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	merges := []bson.M{}
+	opts := options.Find().SetProjection(bson.M{"source": 0, "target": 0, "admins": 0, "tokenIds": 0})
+	cursor, err := models.Collection(models.MergeCollection).Find(ctx, mergeFilter(userID), opts)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &merges)
+	return merges, err
+}
+
+// eraseMerges drops the snapshots of merges involving the user, which makes
+// them irreversible.
+func eraseMerges(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := models.Collection(models.MergeCollection).UpdateMany(ctx, mergeFilter(userID), bson.M{
+		"$unset": bson.M{"source": "", "target": ""},
+	})
+	return err
+}
+
+// exportReviews lists the decisions taken on the user as an admin in access
+// reviews, along with the campaign they belong to.
+func exportReviews(ctx context.Context, userID primitive.ObjectID) (interface{}, error) {
+	cursor, err := models.Collection(models.ReviewCollection).Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"items.userId": userID}},
+		bson.M{"$unwind": "$items"},
+		bson.M{"$match": bson.M{"items.userId": userID}},
+		bson.M{"$project": bson.M{"name": 1, "status": 1, "createTime": 1, "closeTime": 1, "item": "$items"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	items := []bson.M{}
+	err = cursor.All(ctx, &items)
+	return items, err
+}
+
+// eraseReviews replaces the email and name snapshotted for the user in
+// access reviews, as eraseUser does on the account, keeping the decisions.
+func eraseReviews(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := models.Collection(models.ReviewCollection).UpdateMany(ctx, bson.M{"items.userId": userID}, bson.M{
+		"$set": bson.M{
+			"items.$[item].email":    "erased-" + userID.Hex() + "@invalid",
+			"items.$[item].fullName": "Erased user",
+		},
+	}, options.Update().SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"item.userId": userID}}}))
+	return err
+}
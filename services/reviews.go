@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrReviewClosed  = errors.New("access review is closed")
+	errAdminModified = errors.New("admin changed while the review was open")
+)
+
+// ReviewHistoryFields tracks each item under "items.<admin id>", without the
+// name and email of the admin, which history would keep after they are
+// erased.
+func ReviewHistoryFields(review models.Review) bson.M {
+	fields := bson.M{
+		"name":      review.Name,
+		"status":    review.Status,
+		"dueTime":   review.DueTime,
+		"closedBy":  review.ClosedBy,
+		"closeTime": review.CloseTime,
+	}
+	for _, item := range review.Items {
+		fields["items."+item.AdminID.Hex()] = bson.M{
+			"reviewerId": item.ReviewerID,
+			"decision":   item.Decision,
+			"comment":    item.Comment,
+			"decidedBy":  item.DecidedBy,
+			"decideTime": item.DecideTime,
+			"applyTime":  item.ApplyTime,
+			"applyError": item.ApplyError,
+		}
+	}
+	return fields
+}
+
+// StartReview snapshots every active admin and their roles into a new
+// campaign, spreading them over reviewers so that nobody reviews themselves.
+// Admins left without a reviewer can be decided by anyone running reviews.
+func StartReview(ctx context.Context, review models.Review, reviewers []primitive.ObjectID) (models.Review, error) {
+	cursor, err := models.Collection(models.AdminCollection).Aggregate(ctx, bson.A{
+		bson.M{"$match": bson.M{"deleteTime": nil}},
+		bson.M{"$lookup": bson.M{
+			"from":         models.UserCollection,
+			"localField":   "userId",
+			"foreignField": "_id",
+			"as":           "user",
+		}},
+		bson.M{"$addFields": bson.M{"user": bson.M{"$arrayElemAt": bson.A{"$user", 0}}}},
+		bson.M{"$sort": bson.D{{Key: "joinTime", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		return review, err
+	}
+	admins := []models.Admin{}
+	err = cursor.All(ctx, &admins)
+	if err != nil {
+		return review, err
+	}
+
+	review.Items = make([]models.ReviewItem, 0, len(admins))
+	next := 0
+	for _, admin := range admins {
+		item := models.ReviewItem{AdminID: admin.ID, UserID: admin.UserID, Roles: admin.Roles}
+		if admin.User != nil {
+			item.Email = admin.User.Email
+			item.FullName = admin.User.FullName
+		}
+		for range reviewers {
+			reviewer := reviewers[next%len(reviewers)]
+			next++
+			if reviewer != admin.UserID {
+				item.ReviewerID = reviewer
+				break
+			}
+		}
+		review.Items = append(review.Items, item)
+	}
+	review.Status = models.ReviewOpen
+	review.CreateTime = time.Now().Unix()
+	result, err := models.Collection(models.ReviewCollection).InsertOne(ctx, review)
+	if err != nil {
+		return review, err
+	}
+	review.ID = result.InsertedID.(primitive.ObjectID)
+	err = RecordHistory(ctx, models.ReviewCollection, review.ID, HistoryActionCreate, ReviewHistoryFields(models.Review{}), ReviewHistoryFields(review))
+	if err != nil {
+		log.Println("record review history:", err)
+	}
+	return review, nil
+}
+
+// CloseReview closes an open campaign and revokes the admins decided so.
+// Revocations go through GuardAdmins, one that would leave no superadmin or
+// hits an admin changed since the snapshot is kept as ApplyError instead.
+// Undecided admins are left as they are.
+//
+// Revocations deliberately need no approval: each one was decided by a
+// reviewer other than the admin revoked and the campaign is closed by a
+// review.write holder or when due. They only ever take rights away and still
+// go through GuardAdmins.
+func CloseReview(ctx context.Context, id primitive.ObjectID, closedBy primitive.ObjectID) (models.Review, error) {
+	db := models.Collection(models.ReviewCollection)
+	admins := models.Collection(models.AdminCollection)
+	review := models.Review{}
+	now := time.Now().Unix()
+	err := db.FindOneAndUpdate(ctx, bson.M{"_id": id, "status": models.ReviewOpen}, bson.M{"$set": bson.M{
+		"status":    models.ReviewClosed,
+		"closedBy":  closedBy,
+		"closeTime": now,
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&review)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return review, ErrReviewClosed
+	}
+	if err != nil {
+		return review, err
+	}
+	before := review
+	before.Status = models.ReviewOpen
+	before.ClosedBy = primitive.NilObjectID
+	before.CloseTime = 0
+	before.Items = slices.Clone(review.Items)
+
+	for i := range review.Items {
+		item := &review.Items[i]
+		if item.Decision != models.ReviewRevoke {
+			continue
+		}
+		admin := models.Admin{}
+		admins.FindOne(ctx, bson.M{"_id": item.AdminID, "deleteTime": nil}).Decode(&admin)
+		if admin.ID.IsZero() {
+			item.ApplyTime = now
+			continue
+		}
+		if !slices.Equal(admin.Roles, item.Roles) {
+			item.ApplyError = errAdminModified.Error()
+			continue
+		}
+		update := bson.M{"deleteTime": now}
+		result, err := GuardAdmins(ctx, func(ctx mongo.SessionContext) (*mongo.UpdateResult, error) {
+			return helpers.UpdateVersion(ctx, admins, admin.ID, admin.Version, bson.M{"$set": update})
+		})
+		if err == nil && result.MatchedCount == 0 {
+			err = errAdminModified
+		}
+		if err != nil {
+			item.ApplyError = err.Error()
+			continue
+		}
+		item.ApplyTime = now
+		err = RecordHistory(ctx, models.AdminCollection, admin.ID, HistoryActionDelete, bson.M{"deleteTime": admin.DeleteTime}, update)
+		if err != nil {
+			log.Println("record admin history:", err)
+		}
+	}
+	_, err = db.UpdateOne(ctx, bson.M{"_id": review.ID}, bson.M{"$set": bson.M{"items": review.Items}})
+	if err != nil {
+		return review, err
+	}
+	err = RecordHistory(ctx, models.ReviewCollection, review.ID, HistoryActionUpdate, ReviewHistoryFields(before), ReviewHistoryFields(review))
+	if err != nil {
+		log.Println("record review history:", err)
+	}
+	return review, nil
+}
+
+// Reviewers returns the users of the admins allowed to run reviews through
+// their permanent roles, the default reviewers of a campaign.
+func Reviewers(ctx context.Context) ([]primitive.ObjectID, error) {
+	cursor, err := models.Collection(models.AdminCollection).Find(ctx, bson.M{"deleteTime": nil}, options.Find().SetSort(bson.M{"joinTime": 1}))
+	if err != nil {
+		return nil, err
+	}
+	admins := []models.Admin{}
+	err = cursor.All(ctx, &admins)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := Roles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users := []primitive.ObjectID{}
+	for _, admin := range admins {
+		if slices.Contains(resolvePermissions(roles, admin.Roles), enum.PermissionReviewWrite) {
+			users = append(users, admin.UserID)
+		}
+	}
+	return users, nil
+}
+
+// scheduleReviews closes the campaigns past their due time and starts one,
+// due after duration, when the latest is older than interval.
+func scheduleReviews(ctx context.Context, interval time.Duration, duration time.Duration) error {
+	db := models.Collection(models.ReviewCollection)
+	now := time.Now()
+	overdue, err := db.Distinct(ctx, "_id", bson.M{"status": models.ReviewOpen, "dueTime": bson.M{"$lte": now.Unix()}})
+	if err != nil {
+		return err
+	}
+	for _, id := range overdue {
+		_, err := CloseReview(ctx, id.(primitive.ObjectID), primitive.NilObjectID)
+		if err != nil && !errors.Is(err, ErrReviewClosed) {
+			return err
+		}
+	}
+
+	latest := models.Review{}
+	db.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.M{"createTime": -1})).Decode(&latest)
+	if !latest.ID.IsZero() && now.Sub(time.Unix(latest.CreateTime, 0)) < interval {
+		return nil
+	}
+	users, err := Reviewers(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = StartReview(ctx, models.Review{
+		Name:    fmt.Sprintf("Access review %d Q%d", now.Year(), (int(now.Month())-1)/3+1),
+		DueTime: now.Add(duration).Unix(),
+	}, users)
+	return err
+}
+
+// RunAccessReviews starts a campaign every interval, each due after
+// duration, and closes overdue ones. It checks hourly until ctx is done.
+func RunAccessReviews(ctx context.Context, interval time.Duration, duration time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if err := scheduleReviews(ctx, interval, duration); err != nil {
+			log.Println("schedule access reviews:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
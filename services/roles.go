@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sort"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type Permission struct {
+	Key  string `json:"key"`
+	Desc string `json:"desc"`
+}
+
+var permissionCatalog []Permission
+
+// RegisterPermission adds a permission roles can grant to the catalog.
+func RegisterPermission(key string, desc string) {
+	permissionCatalog = append(permissionCatalog, Permission{Key: key, Desc: desc})
+}
+
+func init() {
+	RegisterPermission(enum.PermissionUserRead, "List and read users")
+	RegisterPermission(enum.PermissionUserWrite, "Create and update users")
+	RegisterPermission(enum.PermissionUserDelete, "Delete users")
+	RegisterPermission(enum.PermissionUserEmail, "See the unmasked email of users")
+	RegisterPermission(enum.PermissionUserHistory, "Read the change history of users")
+	RegisterPermission(enum.PermissionUserExport, "Export the data held on users")
+	RegisterPermission(enum.PermissionUserErase, "Erase the personal data of users")
+	RegisterPermission(enum.PermissionUserMerge, "Merge duplicate users")
+	RegisterPermission(enum.PermissionAdminRead, "List and read admins")
+	RegisterPermission(enum.PermissionAdminWrite, "Promote, re-role and revoke admins")
+	RegisterPermission(enum.PermissionRoleRead, "List roles and effective permissions")
+	RegisterPermission(enum.PermissionRoleWrite, "Create, update and delete roles")
+	RegisterPermission(enum.PermissionAttributeWrite, "Define custom user attributes")
+	RegisterPermission(enum.PermissionGroupWrite, "Manage groups and their members")
+	RegisterPermission(enum.PermissionStatsRead, "Read dashboard statistics")
+	RegisterPermission(enum.PermissionReviewWrite, "Run access review campaigns")
+	RegisterPermission(enum.PermissionAuditRead, "Read the audit log")
+}
+
+func Permissions() []Permission {
+	return permissionCatalog
+}
+
+func PermissionExists(key string) bool {
+	return slices.ContainsFunc(permissionCatalog, func(permission Permission) bool {
+		return permission.Key == key
+	})
+}
+
+// Roles returns the built-in roles followed by the custom ones, by key.
+func Roles(ctx context.Context) (map[string]models.Role, error) {
+	roles := map[string]models.Role{}
+	for _, role := range models.BuiltInRoles {
+		roles[role.Key] = role
+	}
+	cursor, err := models.Collection(models.RoleCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	custom := []models.Role{}
+	err = cursor.All(ctx, &custom)
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range custom {
+		if _, ok := roles[role.Key]; !ok {
+			roles[role.Key] = role
+		}
+	}
+	return roles, nil
+}
+
+// resolvePermissions collects the permissions of keys and the roles they
+// inherit. Unknown roles grant nothing and inheritance cycles are cut.
+func resolvePermissions(roles map[string]models.Role, keys []string) []string {
+	permissions := []string{}
+	visited := map[string]bool{}
+	var visit func(key string)
+	visit = func(key string) {
+		role, ok := roles[key]
+		if !ok || visited[key] {
+			return
+		}
+		visited[key] = true
+		for _, permission := range role.Permissions {
+			if permission == models.AllPermissions {
+				for _, catalog := range permissionCatalog {
+					permissions = append(permissions, catalog.Key)
+				}
+				continue
+			}
+			permissions = append(permissions, permission)
+		}
+		for _, parent := range role.Inherits {
+			visit(parent)
+		}
+	}
+	for _, key := range keys {
+		visit(key)
+	}
+	sort.Strings(permissions)
+	return slices.Compact(permissions)
+}
+
+// EffectivePermissions returns the permissions granted by the given roles,
+// inherited ones included.
+func EffectivePermissions(ctx context.Context, keys []string) ([]string, error) {
+	roles, err := Roles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resolvePermissions(roles, keys), nil
+}
+
+// InheritsRole reports whether a role inheriting parents would inherit key,
+// which would make key inherit itself.
+func InheritsRole(roles map[string]models.Role, parents []string, key string) bool {
+	visited := map[string]bool{}
+	var visit func(current string) bool
+	visit = func(current string) bool {
+		if current == key {
+			return true
+		}
+		if visited[current] {
+			return false
+		}
+		visited[current] = true
+		return slices.ContainsFunc(roles[current].Inherits, visit)
+	}
+	return slices.ContainsFunc(parents, visit)
+}
+
+// CanAssignRoles reports whether the admin acting in ctx may grant or revoke
+// every one of roles: they need to hold every permission the roles grant, so
+// nobody can hand out more than they have.
+func CanAssignRoles(ctx context.Context, keys []string) bool {
+	own, _ := ctx.Value(enum.ContextKeyPermissions).([]string)
+	if !slices.Contains(own, enum.PermissionAdminWrite) {
+		return false
+	}
+	roles, err := Roles(ctx)
+	if err != nil {
+		return false
+	}
+	return HoldsPermissions(ctx, resolvePermissions(roles, keys))
+}
+
+// GainsPermissions reports whether an admin holding the roles held would gain
+// any permission from roles too, which makes granting them an escalation. It
+// errs on gaining when roles cannot be loaded.
+func GainsPermissions(ctx context.Context, held []string, roles []string) bool {
+	all, err := Roles(ctx)
+	if err != nil {
+		return true
+	}
+	return gainsPermissions(all, held, roles)
+}
+
+func gainsPermissions(all map[string]models.Role, held []string, roles []string) bool {
+	before := resolvePermissions(all, held)
+	for _, permission := range resolvePermissions(all, roles) {
+		if !slices.Contains(before, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// HoldsPermissions reports whether the admin acting in ctx holds every one of
+// permissions.
+func HoldsPermissions(ctx context.Context, permissions []string) bool {
+	own, _ := ctx.Value(enum.ContextKeyPermissions).([]string)
+	for _, permission := range permissions {
+		if !slices.Contains(own, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// GainedPermissions returns the permissions role would grant, inherited ones
+// included, that it does not grant as it is in roles, all of them for a new
+// role. Roles inheriting it gain no more than that.
+func GainedPermissions(roles map[string]models.Role, role models.Role) []string {
+	before := resolvePermissions(roles, []string{role.Key})
+	changed := maps.Clone(roles)
+	changed[role.Key] = role
+	return slices.DeleteFunc(resolvePermissions(changed, []string{role.Key}), func(permission string) bool {
+		return slices.Contains(before, permission)
+	})
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+)
+
+// testRoles returns the built-in roles along with custom ones.
+func testRoles(custom ...models.Role) map[string]models.Role {
+	roles := map[string]models.Role{}
+	for _, role := range models.BuiltInRoles {
+		roles[role.Key] = role
+	}
+	for _, role := range custom {
+		roles[role.Key] = role
+	}
+	return roles
+}
+
+func TestResolvePermissions(t *testing.T) {
+	roles := testRoles(
+		models.Role{Key: "support", Permissions: []string{enum.PermissionUserWrite}, Inherits: []string{enum.RoleViewer}},
+		models.Role{Key: "loopA", Permissions: []string{enum.PermissionGroupWrite}, Inherits: []string{"loopB"}},
+		models.Role{Key: "loopB", Permissions: []string{enum.PermissionAttributeWrite}, Inherits: []string{"loopA"}},
+	)
+	tests := []struct {
+		name string
+		keys []string
+		want []string
+	}{
+		{"unknown role", []string{"nope"}, []string{}},
+		{"inherited", []string{"support"}, []string{
+			enum.PermissionAdminRead, enum.PermissionRoleRead, enum.PermissionStatsRead,
+			enum.PermissionUserHistory, enum.PermissionUserRead, enum.PermissionUserWrite,
+		}},
+		{"cycle", []string{"loopA"}, []string{enum.PermissionAttributeWrite, enum.PermissionGroupWrite}},
+	}
+	for _, tt := range tests {
+		got := resolvePermissions(roles, tt.keys)
+		want := slices.Clone(tt.want)
+		slices.Sort(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: resolvePermissions = %v, want %v", tt.name, got, want)
+		}
+	}
+	all := resolvePermissions(roles, []string{enum.RoleSuperAdmin})
+	if len(all) != len(permissionCatalog) {
+		t.Errorf("superadmin has %d permissions, want the %d of the catalog", len(all), len(permissionCatalog))
+	}
+}
+
+func TestInheritsRole(t *testing.T) {
+	roles := testRoles(models.Role{Key: "support", Inherits: []string{enum.RoleAdmin}})
+	if !InheritsRole(roles, []string{"support"}, enum.RoleViewer) {
+		t.Error("support should inherit viewer through admin")
+	}
+	if InheritsRole(roles, []string{enum.RoleViewer}, "support") {
+		t.Error("viewer does not inherit support")
+	}
+	if !InheritsRole(roles, []string{"support"}, "support") {
+		t.Error("a role holds itself")
+	}
+}
+
+func TestGainedPermissions(t *testing.T) {
+	support := models.Role{Key: "support", Permissions: []string{enum.PermissionUserWrite}}
+	roles := testRoles(support)
+
+	created := models.Role{Key: "auditor", Permissions: []string{enum.PermissionAuditRead}, Inherits: []string{enum.RoleViewer}}
+	if got := GainedPermissions(roles, created); len(got) != 6 || !slices.Contains(got, enum.PermissionAuditRead) {
+		t.Errorf("new role gains %v, want all of its permissions", got)
+	}
+
+	narrowed := support
+	narrowed.Permissions = nil
+	if got := GainedPermissions(roles, narrowed); len(got) != 0 {
+		t.Errorf("narrowed role gains %v", got)
+	}
+
+	widened := support
+	widened.Permissions = []string{enum.PermissionUserWrite, enum.PermissionUserDelete}
+	widened.Inherits = []string{enum.RoleAdmin}
+	got := GainedPermissions(roles, widened)
+	if slices.Contains(got, enum.PermissionUserWrite) || !slices.Contains(got, enum.PermissionUserDelete) || !slices.Contains(got, enum.PermissionAdminWrite) {
+		t.Errorf("widened role gains %v, want its new permissions only", got)
+	}
+}
+
+func TestHoldsPermissions(t *testing.T) {
+	ctx := context.WithValue(context.Background(), enum.ContextKeyPermissions, []string{enum.PermissionUserRead, enum.PermissionRoleWrite})
+	if !HoldsPermissions(ctx, []string{enum.PermissionRoleWrite}) || !HoldsPermissions(ctx, nil) {
+		t.Error("HoldsPermissions should accept held permissions")
+	}
+	if HoldsPermissions(ctx, []string{enum.PermissionRoleWrite, enum.PermissionAdminWrite}) {
+		t.Error("HoldsPermissions should refuse a permission not held")
+	}
+	if HoldsPermissions(context.Background(), []string{enum.PermissionUserRead}) {
+		t.Error("HoldsPermissions should refuse without permissions in ctx")
+	}
+}
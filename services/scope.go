@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"sort"
+
+	"github.com/anyshare/anyshare-admin-api/enum"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ScopeFilter returns the filter matching the users the admin acting in ctx
+// may manage, nil when their scope covers every user.
+func ScopeFilter(ctx context.Context) bson.M {
+	admin, _ := ctx.Value(enum.ContextKeyAdmin).(models.Admin)
+	if admin.Scope.IsEmpty() {
+		return nil
+	}
+	conditions := bson.A{}
+	if len(admin.Scope.GroupIDs) > 0 {
+		conditions = append(conditions, bson.M{"groupIds": bson.M{"$in": admin.Scope.GroupIDs}})
+	}
+	keys := make([]string, 0, len(admin.Scope.Attributes))
+	for key := range admin.Scope.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		conditions = append(conditions, bson.M{"attributes." + key: bson.M{"$in": admin.Scope.Attributes[key]}})
+	}
+	return bson.M{"$and": conditions}
+}
+
+// ScopeUsers narrows a users filter down to the scope of the admin acting in
+// ctx. Out of scope users then look missing rather than forbidden.
+func ScopeUsers(ctx context.Context, filter bson.M) bson.M {
+	scope := ScopeFilter(ctx)
+	if scope == nil {
+		return filter
+	}
+	return bson.M{"$and": bson.A{filter, scope}}
+}
+
+// ScopeStages returns the aggregation stages keeping only the documents whose
+// users, referenced by id in field, are all in the scope of the admin acting
+// in ctx. There are none when their scope covers every user.
+func ScopeStages(ctx context.Context, field string) bson.A {
+	scope := ScopeFilter(ctx)
+	if scope == nil {
+		return bson.A{}
+	}
+	return bson.A{
+		bson.M{"$lookup": bson.M{
+			"from":         mongodb.GetCollection(schemas.User{}).Name(),
+			"localField":   field,
+			"foreignField": "_id",
+			"pipeline":     bson.A{bson.M{"$match": bson.M{"$nor": bson.A{scope}}}, bson.M{"$project": bson.M{"_id": 1}}},
+			"as":           "outOfScope",
+		}},
+		bson.M{"$match": bson.M{"outOfScope": bson.A{}}},
+		bson.M{"$unset": "outOfScope"},
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/anyshare/anyshare-admin-api/helpers"
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxSearchLength = 100
+	maxSearchTerms  = 8
+)
+
+type searchField struct {
+	name   string
+	weight int
+}
+
+// Searchable user fields and their weight in the relevance score.
+var userSearchFields = []searchField{
+	{"email", 3},
+	{"fullName", 2},
+	{"address", 1},
+}
+
+// UserSearch matches keywords against the normalized "search" shadow fields of
+// users. Keywords are always escaped, never used as a raw pattern.
+type UserSearch struct {
+	phrase string
+	terms  []string
+	fields []searchField
+}
+
+func NewUserSearch(keyword string) *UserSearch {
+	phrase := []rune(helpers.NormalizeSearchText(keyword))
+	if len(phrase) > maxSearchLength {
+		phrase = phrase[:maxSearchLength]
+	}
+	terms := strings.Fields(string(phrase))
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	return &UserSearch{phrase: strings.Join(terms, " "), terms: terms, fields: userSearchFields}
+}
+
+// Fields restricts the search to the given user fields.
+func (s *UserSearch) Fields(names ...string) *UserSearch {
+	fields := []searchField{}
+	for _, field := range userSearchFields {
+		for _, name := range names {
+			if field.name == name {
+				fields = append(fields, field)
+			}
+		}
+	}
+	s.fields = fields
+	return s
+}
+
+func (s *UserSearch) IsEmpty() bool {
+	return len(s.terms) == 0
+}
+
+// Conditions requires every term to appear in at least one searchable field,
+// to be used as the value of an "$and" filter.
+func (s *UserSearch) Conditions(prefix string) bson.A {
+	and := bson.A{}
+	for _, term := range s.terms {
+		or := bson.A{}
+		for _, field := range s.fields {
+			or = append(or, bson.M{prefix + "search." + field.name: bson.M{"$regex": regexp.QuoteMeta(term)}})
+		}
+		and = append(and, bson.M{"$or": or})
+	}
+	return and
+}
+
+// Score ranks exact matches above prefix and word matches, weighted by field.
+func (s *UserSearch) Score(prefix string) bson.M {
+	phrase := regexp.QuoteMeta(s.phrase)
+	scores := bson.A{}
+	for _, field := range s.fields {
+		input := bson.M{"$ifNull": bson.A{"$" + prefix + "search." + field.name, ""}}
+		scores = append(scores,
+			scoreIf(bson.M{"$eq": bson.A{input, s.phrase}}, 100*field.weight),
+			scoreIf(regexMatch(input, "^"+phrase), 20*field.weight),
+		)
+		for _, term := range s.terms {
+			scores = append(scores, scoreIf(regexMatch(input, `(^|[^\p{L}\p{N}])`+regexp.QuoteMeta(term)), 2*field.weight))
+		}
+	}
+	return bson.M{"$add": scores}
+}
+
+// Pipeline returns the aggregation stages listing users matching filter and
+// the search, most relevant first.
+func (s *UserSearch) Pipeline(filter bson.M, skip int64, limit int64) bson.A {
+	return bson.A{
+		bson.M{"$match": bson.M{"$and": append(bson.A{filter}, s.Conditions("")...)}},
+		bson.M{"$addFields": bson.M{"score": s.Score("")}},
+		bson.M{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "joinTime", Value: -1}, {Key: "_id", Value: -1}}},
+		bson.M{"$skip": skip},
+		bson.M{"$limit": limit},
+	}
+}
+
+func scoreIf(cond bson.M, score int) bson.M {
+	return bson.M{"$cond": bson.A{cond, score, 0}}
+}
+
+func regexMatch(input bson.M, pattern string) bson.M {
+	return bson.M{"$regexMatch": bson.M{"input": input, "regex": pattern}}
+}
+
+// UserSearchFields returns the normalized shadow copy of the searchable fields
+// stored under "search" on every user document.
+func UserSearchFields(email string, fullName string, address string) bson.M {
+	return bson.M{
+		"email":    helpers.NormalizeSearchText(email),
+		"fullName": helpers.NormalizeSearchText(fullName),
+		"address":  helpers.NormalizeSearchText(address),
+	}
+}
+
+type searchableUser struct {
+	models.User `bson:",inline"`
+	Search      bson.M `bson:"search"`
+}
+
+// SearchableUser wraps a new user document with its search shadow fields.
+func SearchableUser(user models.User) interface{} {
+	return searchableUser{
+		User:   user,
+		Search: UserSearchFields(user.Email, user.FullName, user.Address),
+	}
+}
+
+// BackfillUserSearch fills the search shadow fields of users created before
+// they existed.
+func BackfillUserSearch(ctx context.Context) error {
+	db := mongodb.GetCollection(schemas.User{})
+	cursor, err := db.Find(ctx, bson.M{"search": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	models := []mongo.WriteModel{}
+	for cursor.Next(ctx) {
+		user := schemas.User{}
+		if err := cursor.Decode(&user); err != nil {
+			return err
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": user.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"search": UserSearchFields(user.Email, user.FullName, user.Address)}}))
+		if len(models) == 500 {
+			if _, err := db.BulkWrite(ctx, models); err != nil {
+				return err
+			}
+			models = models[:0]
+		}
+	}
+	if len(models) > 0 {
+		_, err = db.BulkWrite(ctx, models)
+	}
+	return err
+}
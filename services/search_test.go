@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestNewUserSearch(t *testing.T) {
+	search := NewUserSearch("  Nguyễn   VĂN ")
+	if search.phrase != "nguyen van" || len(search.terms) != 2 {
+		t.Errorf("search = %q %q, want normalized terms", search.phrase, search.terms)
+	}
+	if !NewUserSearch("   ").IsEmpty() {
+		t.Error("blank keyword should give an empty search")
+	}
+	long := NewUserSearch(strings.Repeat("a ", 20))
+	if len(long.terms) != maxSearchTerms {
+		t.Errorf("terms = %d, want at most %d", len(long.terms), maxSearchTerms)
+	}
+}
+
+func TestUserSearchConditionsEscapeInput(t *testing.T) {
+	search := NewUserSearch("a.*b (c+")
+	conditions := search.Conditions("")
+	if len(conditions) != 2 {
+		t.Fatalf("conditions = %v, want one per term", conditions)
+	}
+	for i, term := range search.terms {
+		or := conditions[i].(bson.M)["$or"].(bson.A)
+		if len(or) != len(userSearchFields) {
+			t.Fatalf("term %q matches %d fields, want %d", term, len(or), len(userSearchFields))
+		}
+		for _, cond := range or {
+			for field, value := range cond.(bson.M) {
+				if !strings.HasPrefix(field, "search.") {
+					t.Errorf("condition on %q, want a search shadow field", field)
+				}
+				pattern := value.(bson.M)["$regex"].(string)
+				if !regexp.MustCompile(pattern).MatchString(term) || regexp.MustCompile(pattern).MatchString("axxb") {
+					t.Errorf("pattern %q for %q is not a literal match", pattern, term)
+				}
+			}
+		}
+	}
+}
+
+func TestUserSearchFields(t *testing.T) {
+	search := NewUserSearch("hoa").Fields("fullName")
+	or := search.Conditions("user.")[0].(bson.M)["$or"].(bson.A)
+	if len(or) != 1 || fmt.Sprint(or[0]) != fmt.Sprint(bson.M{"user.search.fullName": bson.M{"$regex": "hoa"}}) {
+		t.Errorf("conditions = %v, want fullName only", or)
+	}
+	fields := UserSearchFields("Hoa@Example.com", "Trần Thị Hoa", "Hà Nội")
+	if fields["fullName"] != "tran thi hoa" || fields["address"] != "ha noi" || fields["email"] != "hoa@example.com" {
+		t.Errorf("UserSearchFields = %v", fields)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/anyshare/anyshare-admin-api/models"
+	"github.com/anyshare/anyshare-common/mongodb"
+	"github.com/anyshare/anyshare-common/schemas"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	StatsIntervalDay   = "day"
+	StatsIntervalWeek  = "week"
+	StatsIntervalMonth = "month"
+)
+
+// StatsRange is the period statistics cover, buckets start at midnight
+// (Monday for weeks) in Location.
+type StatsRange struct {
+	From     time.Time
+	To       time.Time
+	Interval string
+	Location *time.Location
+}
+
+type StatsBucket struct {
+	Date  string `bson:"_id" json:"date"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+type RoleCount struct {
+	Role  string `bson:"_id" json:"role"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+type Stats struct {
+	Signups      []StatsBucket `json:"signups"`
+	Logins       []StatsBucket `json:"logins"`
+	ActiveUsers  int64         `json:"activeUsers"`
+	DeletedUsers int64         `json:"deletedUsers"`
+	AdminRoles   []RoleCount   `json:"adminRoles"`
+}
+
+// bucketStages groups documents with a unix time field in the range, and
+// kept by the scope stages, into buckets labelled by their first day.
+func bucketStages(field string, rg StatsRange, interval string, scope bson.A) bson.A {
+	tz := rg.Location.String()
+	stages := bson.A{bson.M{"$match": bson.M{field: bson.M{"$gte": rg.From.Unix(), "$lt": rg.To.Unix()}}}}
+	stages = append(stages, scope...)
+	return append(stages,
+		bson.M{"$group": bson.M{
+			"_id": bson.M{"$dateToString": bson.M{
+				"format":   "%Y-%m-%d",
+				"timezone": tz,
+				"date": bson.M{"$dateTrunc": bson.M{
+					"date":        bson.M{"$toDate": bson.M{"$multiply": bson.A{"$" + field, 1000}}},
+					"unit":        interval,
+					"timezone":    tz,
+					"startOfWeek": "monday",
+				}},
+			}},
+			"count": bson.M{"$sum": 1},
+		}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	)
+}
+
+func aggregateBuckets(ctx context.Context, pipeline bson.A, collection interface{}) ([]StatsBucket, error) {
+	buckets := []StatsBucket{}
+	cursor, err := mongodb.GetCollection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	err = cursor.All(ctx, &buckets)
+	return buckets, err
+}
+
+// UserStats computes the dashboard statistics over the users in the scope of
+// the admin acting in ctx. Logins are always per day.
+func UserStats(ctx context.Context, rg StatsRange) (Stats, error) {
+	stats := Stats{}
+	var err error
+	userScope := bson.A{}
+	if scope := ScopeFilter(ctx); scope != nil {
+		userScope = append(userScope, bson.M{"$match": scope})
+	}
+	stats.Signups, err = aggregateBuckets(ctx, bucketStages("joinTime", rg, rg.Interval, userScope), schemas.User{})
+	if err != nil {
+		return stats, err
+	}
+	stats.Logins, err = aggregateBuckets(ctx, bucketStages("createTime", rg, StatsIntervalDay, ScopeStages(ctx, "userId")), schemas.UserToken{})
+	if err != nil {
+		return stats, err
+	}
+
+	users := mongodb.GetCollection(schemas.User{})
+	stats.ActiveUsers, err = users.CountDocuments(ctx, ScopeUsers(ctx, bson.M{"deleteTime": nil}))
+	if err != nil {
+		return stats, err
+	}
+	stats.DeletedUsers, err = users.CountDocuments(ctx, ScopeUsers(ctx, bson.M{"deleteTime": bson.M{"$gt": 0}}))
+	if err != nil {
+		return stats, err
+	}
+
+	stats.AdminRoles = []RoleCount{}
+	pipeline := append(bson.A{bson.M{"$match": bson.M{"deleteTime": nil}}}, ScopeStages(ctx, "userId")...)
+	cursor, err := models.Collection(models.AdminCollection).Aggregate(ctx, append(pipeline,
+		bson.M{"$unwind": "$roles"},
+		bson.M{"$group": bson.M{"_id": "$roles", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.M{"_id": 1}},
+	))
+	if err != nil {
+		return stats, err
+	}
+	err = cursor.All(ctx, &stats.AdminRoles)
+	return stats, err
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage keeps binary objects such as avatars under slash separated keys.
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var (
+	defaultStorage Storage
+	defaultOnce    sync.Once
+)
+
+// Default returns the storage configured by STORAGE_DRIVER, "local" (the
+// default) or "s3".
+func Default() Storage {
+	defaultOnce.Do(func() {
+		switch os.Getenv("STORAGE_DRIVER") {
+		case "s3":
+			defaultStorage = &S3{
+				Endpoint:  os.Getenv("S3_ENDPOINT"),
+				Region:    os.Getenv("S3_REGION"),
+				Bucket:    os.Getenv("S3_BUCKET"),
+				AccessKey: os.Getenv("S3_ACCESS_KEY"),
+				SecretKey: os.Getenv("S3_SECRET_KEY"),
+			}
+		default:
+			dir := os.Getenv("STORAGE_LOCAL_DIR")
+			if dir == "" {
+				dir = "uploads"
+			}
+			defaultStorage = &Local{Root: dir}
+		}
+	})
+	return defaultStorage
+}
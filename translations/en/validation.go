@@ -1082,6 +1082,16 @@ func RegisterDefaultTranslations(v *validator.Validate, trans ut.Translator) (er
 			translation: "{0} must be a valid email address",
 			override:    false,
 		},
+		{
+			tag:         "unique_email",
+			translation: "{0} is already in use",
+			override:    false,
+		},
+		{
+			tag:         "role",
+			translation: "{0} must be an existing role",
+			override:    false,
+		},
 		{
 			tag:         "url",
 			translation: "{0} must be a valid URL",
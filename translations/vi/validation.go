@@ -1016,6 +1016,16 @@ func RegisterDefaultTranslations(v *validator.Validate, trans ut.Translator) (er
 			translation: "{0} phải là email thật",
 			override:    false,
 		},
+		{
+			tag:         "unique_email",
+			translation: "{0} đã được sử dụng",
+			override:    false,
+		},
+		{
+			tag:         "role",
+			translation: "{0} phải là một vai trò đã tồn tại",
+			override:    false,
+		},
 		{
 			tag:         "url",
 			translation: "{0} phải là giá trị URL",